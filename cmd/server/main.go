@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/frnksgr/t2m/pkg/t2m"
 )
@@ -12,10 +13,17 @@ var cfg = struct {
 	ListeningPort    string
 	ListeningAddress string
 	TargetURL        string
+	Concurrency      int
+	MaxSize          int
+	// seconds, 0 == calibrate on start only
+	CalibrationInterval int
+	ScratchDir          string
 }{
 	ListeningPort:    "8080",
 	ListeningAddress: "0.0.0.0",
 	TargetURL:        "http://localhost:8080",
+	Concurrency:      100,
+	MaxSize:          1000,
 }
 
 func init() {
@@ -26,7 +34,12 @@ func init() {
 
 func main() {
 	addr := fmt.Sprintf("%s:%s", cfg.ListeningAddress, cfg.ListeningPort)
-	srv := t2m.NewServer(addr, cfg.TargetURL)
+	srv := t2m.NewServer(addr, cfg.TargetURL,
+		t2m.WithConcurrency(cfg.Concurrency),
+		t2m.WithMaxSize(cfg.MaxSize),
+		t2m.WithCalibrationInterval(
+			time.Duration(cfg.CalibrationInterval)*time.Second),
+		t2m.WithScratchDir(cfg.ScratchDir))
 
 	log.Println("Version", t2m.Version)
 	// print cofiguration if in debug mode
@@ -0,0 +1,83 @@
+package t2m
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var errTaskArgument = errors.New("Task argument wrong")
+
+// taskArgs are task specific parameters e.g. load of a cpu task
+// passed on to all request nodes
+type taskArgs map[string]string
+
+// float argument k or default value d
+func (a taskArgs) float(k string, d float64) (float64, error) {
+	v, ok := a[k]
+	if !ok {
+		return d, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, errTaskArgument
+	}
+	return f, nil
+}
+
+// int argument k or default value d
+func (a taskArgs) int(k string, d int) (int, error) {
+	v, ok := a[k]
+	if !ok {
+		return d, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errTaskArgument
+	}
+	return i, nil
+}
+
+// bytes argument k or default value d
+func (a taskArgs) bytes(k string, d uint64) (uint64, error) {
+	v, ok := a[k]
+	if !ok {
+		return d, nil
+	}
+	return parseBytes(v)
+}
+
+// byte units, binary and decimal
+var byteUnits = []struct {
+	suffix string
+	factor float64
+}{
+	// longer suffixes first
+	{"Ki", 1 << 10},
+	{"Mi", 1 << 20},
+	{"Gi", 1 << 30},
+	{"Ti", 1 << 40},
+	{"k", 1e3},
+	{"K", 1e3},
+	{"M", 1e6},
+	{"G", 1e9},
+	{"T", 1e12},
+}
+
+// parse number of bytes with optional unit e.g. 512Mi, 1.5G or 1024
+func parseBytes(s string) (uint64, error) {
+	factor := 1.0
+	for _, u := range byteUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSuffix(s, u.suffix)
+			factor = u.factor
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || f < 0 || f*factor >= 1<<63 {
+		return 0, errTaskArgument
+	}
+	return uint64(f * factor), nil
+}
@@ -0,0 +1,59 @@
+package t2m
+
+import "testing"
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		in  string
+		out uint64
+		err error
+	}{
+		{"0", 0, nil},
+		{"1024", 1024, nil},
+		{"64k", 64000, nil},
+		{"64Ki", 65536, nil},
+		{"100M", 100000000, nil},
+		{"512Mi", 512 << 20, nil},
+		{"1.5Gi", 3 << 29, nil},
+		{"2T", 2000000000000, nil},
+		{"", 0, errTaskArgument},
+		{"Mi", 0, errTaskArgument},
+		{"-1", 0, errTaskArgument},
+		{"10MB", 0, errTaskArgument},
+		{"10Ei", 0, errTaskArgument},
+		{"NaN", 0, errTaskArgument},
+		{"NaNMi", 0, errTaskArgument},
+		{"Inf", 0, errTaskArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseBytes(tt.in)
+			if got != tt.out || err != tt.err {
+				t.Errorf("got %d, %v, want %d, %v", got, err, tt.out, tt.err)
+			}
+		})
+	}
+}
+
+func TestFloatArg(t *testing.T) {
+	tests := []struct {
+		in  string
+		out float64
+		err error
+	}{
+		{"0.5", 0.5, nil},
+		{"1e-3", 0.001, nil},
+		{"x", 0, errTaskArgument},
+		{"NaN", 0, errTaskArgument},
+		{"Inf", 0, errTaskArgument},
+		{"-Inf", 0, errTaskArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := taskArgs{"f": tt.in}.float("f", 1)
+			if got != tt.out || err != tt.err {
+				t.Errorf("got %v, %v, want %v, %v", got, err, tt.out, tt.err)
+			}
+		})
+	}
+}
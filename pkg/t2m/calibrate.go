@@ -0,0 +1,60 @@
+package t2m
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// calibration of cpuloop
+var calibration = struct {
+	sync.RWMutex
+	// iterations of spin per micro sec
+	loops float64
+	// time of last calibration, zero if not calibrated yet
+	at time.Time
+}{
+	// statically calibrated on Intel(R) Xeon(R) CPU E5-2667 0 @ 2.90GHz
+	loops: 3300,
+}
+
+func loopsPerMicrosecond() float64 {
+	calibration.RLock()
+	defer calibration.RUnlock()
+	return calibration.loops
+}
+
+// measure iterations of spin per micro sec on this machine
+// use the fastest of some short runs to reduce effects
+// of preemption and concurrent load
+func calibrateCPU() float64 {
+	const count = 5 * 1000 * 1000
+	best := time.Duration(0)
+	for i := 0; i < 5; i++ {
+		t := time.Now()
+		spin(count)
+		if d := time.Since(t); best == 0 || d < best {
+			best = d
+		}
+	}
+	loops := float64(count) * float64(time.Microsecond) / float64(best)
+
+	calibration.Lock()
+	calibration.loops = loops
+	calibration.at = time.Now()
+	calibration.Unlock()
+	return loops
+}
+
+// calibrate now and then every interval, if interval > 0
+func startCalibration(interval time.Duration) {
+	log.Printf("CPU calibrated: %.1f loops per micro sec", calibrateCPU())
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			calibrateCPU()
+		}
+	}()
+}
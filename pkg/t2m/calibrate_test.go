@@ -0,0 +1,18 @@
+package t2m
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalibrateCPU(t *testing.T) {
+	if calibrateCPU() <= 0 {
+		t.Fatal("expecting positive loops per micro sec")
+	}
+	// allow for noise of a loaded test machine
+	start := time.Now()
+	cpuloop(20000)
+	if d := time.Since(start); d < 10*time.Millisecond || d > 200*time.Millisecond {
+		t.Errorf("cpuloop(20000) took %s, expecting about 20ms", d)
+	}
+}
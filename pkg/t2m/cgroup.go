@@ -0,0 +1,114 @@
+package t2m
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var errNoCgroup = errors.New("No cgroup found")
+
+// mount point of cgroup file system
+// as seen from within a container i.e. with its own cgroup namespace
+var cgroupRoot = "/sys/fs/cgroup"
+
+// resource limits of the cgroup of this process
+type cgroupLimits struct {
+	// cgroup version 1 or 2
+	Version int `json:"version"`
+	// memory limit in bytes, 0 == unlimited
+	Memory uint64 `json:"memory"`
+	// CPU quota in cores, 0 == unlimited
+	CPU float64 `json:"cpu"`
+}
+
+// read first line of file
+func readLine(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.SplitN(string(b), "\n", 2)[0]), nil
+}
+
+// read cgroup limits from cgroup file system mounted at root
+func readCgroupLimits(root string) (*cgroupLimits, error) {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		return readCgroupV2Limits(root)
+	}
+	if _, err := os.Stat(filepath.Join(root, "memory")); err == nil {
+		return readCgroupV1Limits(root)
+	}
+	return nil, errNoCgroup
+}
+
+// cgroup v2: unified hierarchy
+// memory.max: "max" or bytes
+// cpu.max: "max <period>" or "<quota> <period>" in micro sec
+func readCgroupV2Limits(root string) (*cgroupLimits, error) {
+	l := &cgroupLimits{Version: 2}
+	if s, err := readLine(filepath.Join(root, "memory.max")); err == nil && s != "max" {
+		if l.Memory, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	if s, err := readLine(filepath.Join(root, "cpu.max")); err == nil {
+		f := strings.Fields(s)
+		if len(f) == 2 && f[0] != "max" {
+			quota, err := strconv.ParseFloat(f[0], 64)
+			if err != nil {
+				return nil, err
+			}
+			period, err := strconv.ParseFloat(f[1], 64)
+			if err != nil || period <= 0 {
+				return nil, errNoCgroup
+			}
+			l.CPU = quota / period
+		}
+	}
+	return l, nil
+}
+
+// cgroup v1: one hierarchy per controller
+// memory/memory.limit_in_bytes: bytes, very large if unlimited
+// cpu/cpu.cfs_quota_us: micro sec, -1 if unlimited
+// cpu/cpu.cfs_period_us: micro sec
+func readCgroupV1Limits(root string) (*cgroupLimits, error) {
+	l := &cgroupLimits{Version: 1}
+	p := filepath.Join(root, "memory", "memory.limit_in_bytes")
+	if s, err := readLine(p); err == nil {
+		m, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if m < 1<<62 { // unlimited is reported as max int64 rounded to pages
+			l.Memory = m
+		}
+	}
+	for _, d := range []string{"cpu", "cpu,cpuacct"} {
+		qs, err := readLine(filepath.Join(root, d, "cpu.cfs_quota_us"))
+		if err != nil {
+			continue
+		}
+		ps, err := readLine(filepath.Join(root, d, "cpu.cfs_period_us"))
+		if err != nil {
+			continue
+		}
+		quota, err := strconv.ParseFloat(qs, 64)
+		if err != nil {
+			return nil, err
+		}
+		period, err := strconv.ParseFloat(ps, 64)
+		if err != nil || period <= 0 {
+			return nil, errNoCgroup
+		}
+		if quota > 0 {
+			l.CPU = quota / period
+		}
+		break
+	}
+	return l, nil
+}
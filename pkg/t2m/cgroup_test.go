@@ -0,0 +1,135 @@
+package t2m
+
+import (
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// create fake cgroup file system with given files
+func fakeCgroup(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestReadCgroupLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  cgroupLimits
+	}{
+		{"v2", map[string]string{
+			"cgroup.controllers": "cpu memory\n",
+			"memory.max":         "67108864\n",
+			"cpu.max":            "150000 100000\n",
+		}, cgroupLimits{Version: 2, Memory: 64 << 20, CPU: 1.5}},
+		{"v2 unlimited", map[string]string{
+			"cgroup.controllers": "cpu memory\n",
+			"memory.max":         "max\n",
+			"cpu.max":            "max 100000\n",
+		}, cgroupLimits{Version: 2}},
+		{"v1", map[string]string{
+			"memory/memory.limit_in_bytes": "268435456\n",
+			"cpu/cpu.cfs_quota_us":         "50000\n",
+			"cpu/cpu.cfs_period_us":        "100000\n",
+		}, cgroupLimits{Version: 1, Memory: 256 << 20, CPU: 0.5}},
+		{"v1 unlimited", map[string]string{
+			"memory/memory.limit_in_bytes":  "9223372036854771712\n",
+			"cpu,cpuacct/cpu.cfs_quota_us":  "-1\n",
+			"cpu,cpuacct/cpu.cfs_period_us": "100000\n",
+		}, cgroupLimits{Version: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := fakeCgroup(t, tt.files)
+			defer os.RemoveAll(root)
+			got, err := readCgroupLimits(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+
+	root := fakeCgroup(t, nil)
+	defer os.RemoveAll(root)
+	if _, err := readCgroupLimits(root); err != errNoCgroup {
+		t.Errorf("got %v, want %v", err, errNoCgroup)
+	}
+}
+
+func TestRAMFraction(t *testing.T) {
+	root := fakeCgroup(t, map[string]string{
+		"cgroup.controllers": "memory\n",
+		"memory.max":         "1048576\n",
+	})
+	defer os.RemoveAll(root)
+	defer func(r string) { cgroupRoot = r }(cgroupRoot)
+	cgroupRoot = root
+
+	n := &node{TaskName: "ram", TaskArgs: taskArgs{"fraction": "0.5"},
+		TaskDuration: 1, logger: log.New(ioutil.Discard, "", 0)}
+	r := n.execTask()
+	if r["bytes"] != uint64(512*1024) {
+		t.Errorf("got report %v, want 512Ki bytes", r)
+	}
+}
+
+func TestCPUQuota(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	defer func(r string) { cgroupRoot = r }(cgroupRoot)
+	tests := []struct {
+		name  string
+		files map[string]string
+		quota float64 // CPUs taken as quota
+	}{
+		{"limit", map[string]string{
+			"cgroup.controllers": "cpu\n",
+			"cpu.max":            "150000 100000\n",
+		}, 1.5},
+		{"unlimited", map[string]string{
+			"cgroup.controllers": "cpu\n",
+			"cpu.max":            "max 100000\n",
+		}, float64(runtime.NumCPU())},
+		{"no cgroup", nil, float64(runtime.NumCPU())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := fakeCgroup(t, tt.files)
+			defer os.RemoveAll(root)
+			cgroupRoot = root
+
+			r := runTasklet(cpuQuota(1), 20*time.Millisecond)
+			cores := int(math.Ceil(tt.quota))
+			if cores > 4 {
+				cores = 4
+			}
+			load := math.Min(1, tt.quota/float64(cores))
+			if r["quota"] != 1.0 || r["cores"] != cores || r["load"] != load {
+				t.Errorf("got report %v, want %d cores with load %v", r, cores, load)
+			}
+			if _, ok := r["cgroup"]; ok != (tt.files != nil) {
+				t.Errorf("got cgroup %v in report %v", ok, r)
+			}
+		})
+	}
+}
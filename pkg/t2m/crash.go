@@ -0,0 +1,47 @@
+package t2m
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+// held shared by every request,
+// the crash task deadlocks the server by acquiring it exclusively
+var serving sync.RWMutex
+
+// crash after done
+// exit: exit process with code
+// panic: runtime panic not recovered by the http server
+// kill: kill process with SIGKILL
+// deadlock: block all requests forever, including health checks
+// hang: never complete the request, without exiting
+func crash(mode string, code int) tasklet {
+	return func(l *log.Logger, done <-chan struct{}, r taskReport) {
+		l.Println("Start crashing")
+		<-done
+		l.Printf("End crashing: %s\n", mode)
+		switch mode {
+		case "exit":
+			os.Exit(code)
+		case "panic":
+			go func() {
+				var p *int
+				*p = 0 // nil pointer dereference
+			}()
+		case "kill":
+			p, err := os.FindProcess(os.Getpid())
+			if err == nil {
+				err = p.Kill()
+			}
+			if err != nil {
+				l.Fatalln(err)
+			}
+		case "deadlock":
+			// waits for this request, which waits for this task
+			serving.Lock()
+		}
+		// wait for process to end or forever
+		select {}
+	}
+}
@@ -0,0 +1,105 @@
+package t2m
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// upper bound of sampled task durations
+// long tailed distributions might yield arbitrary large values
+const maxSampledDuration = time.Hour
+
+// distribution of task durations in ms e.g. normal(50,10)
+type distribution struct {
+	name   string
+	params []float64
+}
+
+var distributionRe = regexp.MustCompile(`^(\w+)\(([^()]*)\)$`)
+
+// number of parameters per distribution
+var distributionParams = map[string]int{
+	"normal":  2, // mean, standard deviation
+	"exp":     1, // mean
+	"pareto":  2, // scale i.e. minimum, shape
+	"uniform": 2, // minimum, maximum
+}
+
+// parse distribution spec s e.g. exp(40)
+// return errQueryParameter if s is invalid
+func parseDistribution(s string) (*distribution, error) {
+	m := distributionRe.FindStringSubmatch(strings.ReplaceAll(s, " ", ""))
+	if m == nil {
+		return nil, errQueryParameter
+	}
+	d := &distribution{name: m[1]}
+	for _, f := range strings.Split(m[2], ",") {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, errQueryParameter
+		}
+		d.params = append(d.params, v)
+	}
+	if len(d.params) != distributionParams[d.name] {
+		return nil, errQueryParameter
+	}
+	p := d.params
+	valid := false
+	switch d.name {
+	case "normal":
+		valid = p[1] >= 0
+	case "exp":
+		valid = p[0] > 0
+	case "pareto":
+		valid = p[0] > 0 && p[1] > 0
+	case "uniform":
+		valid = p[0] >= 0 && p[0] <= p[1]
+	}
+	if !valid {
+		return nil, errQueryParameter
+	}
+	return d, nil
+}
+
+func (d *distribution) String() string {
+	ps := make([]string, len(d.params))
+	for i, p := range d.params {
+		ps[i] = strconv.FormatFloat(p, 'g', -1, 64)
+	}
+	return fmt.Sprintf("%s(%s)", d.name, strings.Join(ps, ","))
+}
+
+// uniform random number within (0, 1] derived from x
+func unit(x uint64) float64 {
+	return float64(mix(x)>>11+1) / (1 << 53)
+}
+
+// sample duration of request node index using seed
+// samples are reproducible i.e. the same for the same seed and index
+func (d *distribution) sample(seed int64, index int) time.Duration {
+	// decorrelated from random parents derived from seed and index
+	x := mix(mix(uint64(seed) ^ mix(uint64(index))))
+	u := unit(x)
+	p := d.params
+	v := 0.0
+	switch d.name {
+	case "normal":
+		// Box-Muller transform
+		v = p[0] + p[1]*math.Sqrt(-2*math.Log(u))*math.Cos(2*math.Pi*unit(x+1))
+	case "exp":
+		v = -p[0] * math.Log(u)
+	case "pareto":
+		v = p[0] / math.Pow(u, 1/p[1])
+	case "uniform":
+		v = p[0] + (p[1]-p[0])*(1-u)
+	}
+	v = math.Max(0, v)
+	if v >= ms(maxSampledDuration) {
+		return maxSampledDuration
+	}
+	return time.Duration(v * float64(time.Millisecond))
+}
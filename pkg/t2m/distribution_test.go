@@ -0,0 +1,94 @@
+package t2m
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseDistribution(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"normal(50,10)", "normal(50,10)"},
+		{"normal(50, 0)", "normal(50,0)"},
+		{"exp(40.5)", "exp(40.5)"},
+		{"pareto(20,1.5)", "pareto(20,1.5)"},
+		{"uniform(10,100)", "uniform(10,100)"},
+		{"uniform(10,10)", "uniform(10,10)"},
+		{"normal(50,-10)", ""},
+		{"exp(0)", ""},
+		{"exp(40,1)", ""},
+		{"pareto(0,1.5)", ""},
+		{"uniform(100,10)", ""},
+		{"uniform(10,NaN)", ""},
+		{"gamma(2,2)", ""},
+		{"exp(40", ""},
+		{"50", ""},
+	}
+	for _, tt := range tests {
+		d, err := parseDistribution(tt.spec)
+		if tt.want == "" {
+			if err != errQueryParameter {
+				t.Errorf("%s: got %v, want %v", tt.spec, err, errQueryParameter)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.spec, err)
+			continue
+		}
+		if d.String() != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.spec, d, tt.want)
+		}
+	}
+}
+
+func TestSampleDistribution(t *testing.T) {
+	tests := []struct {
+		spec     string
+		mean     float64
+		min, max float64
+	}{
+		{"normal(50,10)", 50, 0, math.Inf(1)},
+		{"exp(40)", 40, 0, math.Inf(1)},
+		{"pareto(20,3)", 30, 20, math.Inf(1)},
+		{"uniform(10,100)", 55, 10, 100},
+	}
+	const count = 10000
+	for _, tt := range tests {
+		d, err := parseDistribution(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := 0.0
+		for i := 1; i <= count; i++ {
+			v := ms(d.sample(42, i))
+			if v < tt.min || v > tt.max {
+				t.Fatalf("%s: sample %f not within [%f, %f]", tt.spec, v, tt.min, tt.max)
+			}
+			sum += v
+		}
+		if mean := sum / count; math.Abs(mean-tt.mean) > tt.mean*0.05 {
+			t.Errorf("%s: mean %f, want about %f", tt.spec, mean, tt.mean)
+		}
+		if d.sample(42, 7) != d.sample(42, 7) {
+			t.Errorf("%s: samples not reproducible", tt.spec)
+		}
+		if d.sample(42, 7) == d.sample(43, 7) {
+			t.Errorf("%s: samples independent of seed", tt.spec)
+		}
+	}
+	d, _ := parseDistribution("pareto(1000,0.1)")
+	for i := 1; i <= count; i++ {
+		if d.sample(1, i) > maxSampledDuration {
+			t.Fatal("sample exceeds limit")
+		}
+	}
+	d, _ = parseDistribution("normal(0,1000)")
+	for i := 1; i <= count; i++ {
+		if d.sample(1, i) < 0 {
+			t.Fatal("negative sample")
+		}
+	}
+}
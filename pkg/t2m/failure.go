@@ -0,0 +1,89 @@
+package t2m
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Failures are injected in request nodes selected by task arguments
+// p: probability of failure and at: selector of nodes
+// All other nodes sleep.
+
+// selector of request nodes e.g. leaves, root, depth:2 or index:5-9
+type selector struct {
+	kind     string
+	from, to int
+}
+
+// parse selector s
+// return errTaskArgument if s is invalid
+func parseSelector(s string) (*selector, error) {
+	switch s {
+	case "leaves", "root":
+		return &selector{kind: s}, nil
+	}
+	f := strings.SplitN(s, ":", 2)
+	if len(f) != 2 || (f[0] != "depth" && f[0] != "index") {
+		return nil, errTaskArgument
+	}
+	sl := &selector{kind: f[0]}
+	r := strings.SplitN(f[1], "-", 2)
+	var err error
+	if sl.from, err = strconv.Atoi(r[0]); err != nil || sl.from < 0 {
+		return nil, errTaskArgument
+	}
+	sl.to = sl.from
+	if len(r) == 2 {
+		if sl.to, err = strconv.Atoi(r[1]); err != nil || sl.to < sl.from {
+			return nil, errTaskArgument
+		}
+	}
+	return sl, nil
+}
+
+// check request node n is selected
+func (sl *selector) match(n *node) bool {
+	switch sl.kind {
+	case "root":
+		return n.ParentIndex == 0
+	case "leaves":
+		return len(n.children()) == 0
+	case "depth":
+		return n.Depth >= sl.from && n.Depth <= sl.to
+	case "index":
+		return n.Index >= sl.from && n.Index <= sl.to
+	}
+	return false
+}
+
+// validate arguments selecting nodes a failure is injected in
+func validInjection(a taskArgs) bool {
+	p, err := a.float("p", 1)
+	if err != nil || p < 0 || p > 1 {
+		return false
+	}
+	if at, ok := a["at"]; ok {
+		if _, err := parseSelector(at); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// check a failure is injected in request node n
+// nodes matching the selector fail with probability p,
+// decided by seed and index to be reproducible
+func (n *node) injected() bool {
+	if at, ok := n.TaskArgs["at"]; ok {
+		sl, err := parseSelector(at)
+		if err != nil || !sl.match(n) {
+			return false
+		}
+	}
+	p, err := n.TaskArgs.float("p", 1)
+	if err != nil {
+		return false
+	}
+	// decorrelated from random parents and sampled durations
+	return unit(mix(uint64(n.Seed)^mix(uint64(n.Index)))^0xfa11) <= p
+}
@@ -0,0 +1,91 @@
+package t2m
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		s    string
+		want *selector
+	}{
+		{"leaves", &selector{kind: "leaves"}},
+		{"root", &selector{kind: "root"}},
+		{"depth:2", &selector{"depth", 2, 2}},
+		{"index:5-9", &selector{"index", 5, 9}},
+		{"index:9-5", nil},
+		{"index:-5", nil},
+		{"depth:x", nil},
+		{"height:2", nil},
+		{"all", nil},
+	}
+	for _, tt := range tests {
+		sl, err := parseSelector(tt.s)
+		if tt.want == nil {
+			if err != errTaskArgument {
+				t.Errorf("%s: got %v, want %v", tt.s, err, errTaskArgument)
+			}
+			continue
+		}
+		if err != nil || *sl != *tt.want {
+			t.Errorf("%s: got %v, %v, want %v", tt.s, sl, err, tt.want)
+		}
+	}
+}
+
+// indices of nodes of request u a failure is injected in
+func injected(t *testing.T, u string) []int {
+	pu, err := url.Parse(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := newNodeFromURL(pu, defaultMaxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	is := []int{}
+	for _, c := range walk(n) {
+		if c.injected() {
+			is = append(is, c.Index)
+		}
+	}
+	return is
+}
+
+func TestInjected(t *testing.T) {
+	tests := []struct {
+		url  string
+		want []int
+	}{
+		{"/fail?size=3", []int{1, 2, 3}},
+		{"/fail?size=3&at=root", []int{1}},
+		{"/fail?size=7&topology=tree&at=leaves", []int{4, 5, 6, 7}},
+		{"/fail?size=7&topology=tree&at=depth:1", []int{2, 3}},
+		{"/crash?size=7&topology=tree&at=index:3-5", []int{3, 4, 5}},
+		{"/fail?size=7&p=0", []int{}},
+	}
+	for _, tt := range tests {
+		got := injected(t, tt.url)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.url, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.url, got, tt.want)
+				break
+			}
+		}
+	}
+
+	// about p of selected nodes, the same for the same seed
+	u := "/fail?size=1000&p=0.1&at=leaves&seed=42"
+	got := injected(t, u)
+	if len(got) < 70 || len(got) > 130 {
+		t.Errorf("%s: %d nodes failing, want about 100", u, len(got))
+	}
+	if again := injected(t, u); len(again) != len(got) {
+		t.Errorf("%s: not reproducible", u)
+	}
+}
@@ -0,0 +1,61 @@
+package t2m
+
+import (
+	"log"
+	"runtime"
+	"time"
+)
+
+// allocate short lived objects on the Go heap until stopped
+// rate: bytes per sec
+// size: bytes per object
+// Reports GC cycles and pauses during task execution.
+func gc(rate, size uint64) tasklet {
+	return func(l *log.Logger, done <-chan struct{}, r taskReport) {
+		l.Printf("Allocate %d bytes per sec in objects of %d bytes\n", rate, size)
+		// recently allocated objects, keeps them alive for a short while
+		// so that allocations are not optimized away
+		sink := make([][]byte, 1024)
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+
+		const period = 10 * time.Millisecond
+		perPeriod := float64(rate) * period.Seconds() / float64(size)
+		var objects uint64
+		start := time.Now()
+		for end := false; !end; {
+			select {
+			case <-done:
+				end = true
+			default:
+				// allocate objects due until end of this period
+				p := time.Since(start) / period
+				due := uint64(perPeriod * float64(p+1))
+				for ; objects < due; objects++ {
+					sink[objects%uint64(len(sink))] = make([]byte, size)
+				}
+				time.Sleep(start.Add((p + 1) * period).Sub(time.Now()))
+			}
+		}
+
+		runtime.ReadMemStats(&after)
+		cycles := after.NumGC - before.NumGC
+		r["bytes"] = objects * size
+		r["objects"] = objects
+		r["gcCycles"] = cycles
+		r["gcPauseTotal"] = ms(time.Duration(after.PauseTotalNs - before.PauseTotalNs))
+		// pauses of recent cycles are kept in a circular buffer
+		if cycles > uint32(len(after.PauseNs)) {
+			cycles = uint32(len(after.PauseNs))
+		}
+		max := uint64(0)
+		for i := uint32(0); i < cycles; i++ {
+			p := after.PauseNs[(after.NumGC-i+255)%256]
+			if p > max {
+				max = p
+			}
+		}
+		r["gcPauseMax"] = ms(time.Duration(max))
+		l.Printf("End allocating after %d GC cycles\n", after.NumGC-before.NumGC)
+	}
+}
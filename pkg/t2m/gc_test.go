@@ -0,0 +1,34 @@
+package t2m
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGC(t *testing.T) {
+	r := runTasklet(gc(100*1024*1024, 1024), 200*time.Millisecond)
+	// about 20Mi within 200ms
+	if b := r["bytes"].(uint64); b < 10*1024*1024 || b > 30*1024*1024 {
+		t.Errorf("allocated %d bytes, want about %d", b, 20*1024*1024)
+	}
+	if r["gcCycles"].(uint32) == 0 {
+		t.Error("no GC cycles")
+	}
+	if r["gcPauseMax"].(float64) > r["gcPauseTotal"].(float64) {
+		t.Errorf("max pause %v exceeds total %v", r["gcPauseMax"], r["gcPauseTotal"])
+	}
+}
+
+func TestGCConcurrent(t *testing.T) {
+	// e.g. child nodes of a fan served by the same server
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runTasklet(gc(10*1024*1024, 1024), 50*time.Millisecond)
+		}()
+	}
+	wg.Wait()
+}
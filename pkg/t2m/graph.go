@@ -0,0 +1,160 @@
+package t2m
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+var errInvalidGraph = errors.New("Graph invalid")
+
+// graphNode describes a single request node of a user defined graph
+type graphNode struct {
+	// Unique index of request node (starting at 1, 1 == root node)
+	Index int `json:"index"`
+	// Name of task, defaults to task of request URL
+	Task string `json:"task,omitempty"`
+	// Task specific arguments, default to arguments of request URL
+	// if task defaults to task of request URL
+	Args taskArgs `json:"args,omitempty"`
+	// Duration of task execution in ms, defaults to time of request URL
+	// 0 == sampled from time distribution of request URL
+	Time int `json:"time,omitempty"`
+	// Indices of child nodes
+	Children []int `json:"children,omitempty"`
+}
+
+// graph is a user defined request graph
+// e.g. replayed from call graphs recorded in production
+// A node with more than one parent (fan-in) is either called by every
+// parent or just by its first parent, depending on the join mode.
+type graph struct {
+	Nodes []graphNode `json:"nodes"`
+}
+
+// upper bound of the encoded size of a graph of at most maxSize nodes
+// generous for nodes with task arguments and children
+func maxGraphBytes(maxSize int) int64 {
+	return 4096 + int64(maxSize)*1024
+}
+
+// decode a graph from r and validate it
+// task and time of graph nodes default to task and time given,
+// args default to args given if task does
+// maxSize limits the number of calls
+func decodeGraph(r io.Reader, task string, args taskArgs, time int, maxSize int) (*graph, error) {
+	g := &graph{}
+	if err := json.NewDecoder(r).Decode(g); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidGraph, err)
+	}
+	for i := range g.Nodes {
+		if g.Nodes[i].Task == "" {
+			g.Nodes[i].Task = task
+			// arguments are specific to task
+			if g.Nodes[i].Args == nil {
+				g.Nodes[i].Args = args
+			}
+		}
+		if g.Nodes[i].Time == 0 {
+			g.Nodes[i].Time = time
+		}
+	}
+	if err := g.validate(maxSize); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// check graph is a directed acyclic graph with node indices 1 ... size
+// where all nodes are reachable from root node 1
+// sort nodes by index so that node i can be found at position i-1
+func (g *graph) validate(maxSize int) error {
+	size := len(g.Nodes)
+	if size < 1 || size > maxSize {
+		return fmt.Errorf("%w: number of nodes must be within 1 ... %d",
+			errInvalidGraph, maxSize)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].Index < g.Nodes[j].Index
+	})
+	// number of parents per node
+	parents := make([]int, size+1)
+	for i, gn := range g.Nodes {
+		if gn.Index != i+1 {
+			return fmt.Errorf("%w: node indices must be 1 ... %d",
+				errInvalidGraph, size)
+		}
+		if !validTask(gn.Task) {
+			return fmt.Errorf("%w: node %d: %s",
+				errInvalidGraph, gn.Index, errUnknownTask)
+		}
+		if _, err := createTasklet(gn.Task, gn.Args, ""); err != nil {
+			return fmt.Errorf("%w: node %d: %s",
+				errInvalidGraph, gn.Index, err)
+		}
+		if gn.Time < 0 {
+			return fmt.Errorf("%w: node %d: time must not be negative",
+				errInvalidGraph, gn.Index)
+		}
+		for j, c := range gn.Children {
+			if c < 2 || c > size {
+				return fmt.Errorf("%w: node %d: unknown child %d",
+					errInvalidGraph, gn.Index, c)
+			}
+			for _, cc := range gn.Children[:j] {
+				if cc == c {
+					return fmt.Errorf("%w: node %d: duplicate child %d",
+						errInvalidGraph, gn.Index, c)
+				}
+			}
+			parents[c]++
+		}
+	}
+	// visit nodes in topological order starting at root node
+	// counting the number of calls per node if every parent calls
+	// its children. Nodes not visited are either not reachable
+	// from root node or part of a cycle.
+	calls := make([]int, size+1)
+	calls[1] = 1
+	total, visited := 0, 0
+	for todo := []int{1}; len(todo) > 0; todo = todo[1:] {
+		i := todo[0]
+		visited++
+		total += calls[i]
+		if total > maxSize {
+			return fmt.Errorf("%w: more than %d calls",
+				errInvalidGraph, maxSize)
+		}
+		for _, c := range g.node(i).Children {
+			calls[c] += calls[i]
+			if parents[c]--; parents[c] == 0 {
+				todo = append(todo, c)
+			}
+		}
+	}
+	if visited != size {
+		return fmt.Errorf("%w: graph has cycles or nodes not reachable "+
+			"from root node", errInvalidGraph)
+	}
+	return nil
+}
+
+// index of first parent of node with index i
+// this is the parent calling node i if joins are deduplicated
+func (g *graph) firstParent(i int) int {
+	for _, gn := range g.Nodes {
+		for _, c := range gn.Children {
+			if c == i {
+				return gn.Index
+			}
+		}
+	}
+	return 0
+}
+
+// graph node with index i
+func (g *graph) node(i int) *graphNode {
+	return &g.Nodes[i-1]
+}
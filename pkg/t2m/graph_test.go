@@ -0,0 +1,165 @@
+package t2m
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDecodeGraph(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		ok   bool
+	}{
+		{"single", `{"nodes": [{"index": 1}]}`, true},
+		{"tree", `{"nodes": [{"index": 2, "children": [3]},
+			{"index": 1, "task": "cpu", "children": [2, 4]},
+			{"index": 3, "time": 10}, {"index": 4}]}`, true},
+		{"empty", `{"nodes": []}`, false},
+		{"malformed", `{"nodes": [`, false},
+		{"gap", `{"nodes": [{"index": 1, "children": [3]}, {"index": 3}]}`, false},
+		{"unknown child", `{"nodes": [{"index": 1, "children": [2]}]}`, false},
+		{"root child", `{"nodes": [{"index": 1, "children": [1]}]}`, false},
+		{"unknown task", `{"nodes": [{"index": 1, "task": "dance"}]}`, false},
+		{"task args", `{"nodes": [{"index": 1, "task": "ram",
+			"args": {"bytes": "64Mi"}}]}`, true},
+		{"wrong task args", `{"nodes": [{"index": 1, "task": "cpu",
+			"args": {"load": "2"}}]}`, false},
+		{"two parents", `{"nodes": [{"index": 1, "children": [2, 3]},
+			{"index": 2, "children": [3]}, {"index": 3}]}`, true},
+		{"duplicate child", `{"nodes": [{"index": 1, "children": [2, 2]},
+			{"index": 2}]}`, false},
+		{"cycle", `{"nodes": [{"index": 1},
+			{"index": 2, "children": [3]}, {"index": 3, "children": [2]}]}`, false},
+		{"reachable cycle", `{"nodes": [{"index": 1, "children": [2]},
+			{"index": 2, "children": [3]}, {"index": 3, "children": [2]}]}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeGraph(strings.NewReader(tt.body), "sleep", nil, 50, 1000)
+			if tt.ok && err != nil {
+				t.Errorf("unexpected error %s", err)
+			}
+			if !tt.ok && !errors.Is(err, errInvalidGraph) {
+				t.Errorf("got %v, want %v", err, errInvalidGraph)
+			}
+		})
+	}
+
+	t.Run("mixed tasks", func(t *testing.T) {
+		// arguments of crash are not passed to other tasks
+		body := `{"nodes": [{"index": 1, "children": [2, 3, 4]},
+			{"index": 2, "task": "conn"}, {"index": 3, "task": "status"},
+			{"index": 4, "task": "crash", "args": {"mode": "exit"}}]}`
+		g, err := decodeGraph(strings.NewReader(body), "crash",
+			taskArgs{"mode": "kill"}, 50, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, want := range []string{"kill", "", "", "exit"} {
+			if got := g.node(i + 1).Args["mode"]; got != want {
+				t.Errorf("node %d: got mode %q, want %q", i+1, got, want)
+			}
+		}
+	})
+}
+
+func TestGraphChildren(t *testing.T) {
+	body := `{"nodes": [{"index": 1, "children": [2, 3]},
+		{"index": 2, "task": "cpu", "time": 100},
+		{"index": 3, "children": [4]}, {"index": 4}]}`
+	root := &node{Index: 1, TaskName: "sleep", TaskDuration: 20}
+	if err := root.setGraph(strings.NewReader(body), 1000); err != nil {
+		t.Fatal(err)
+	}
+	nodes := walk(root)
+	if len(nodes) != 4 {
+		t.Fatalf("got %d nodes, want 4", len(nodes))
+	}
+	for _, n := range nodes {
+		task, time := "sleep", 20
+		if n.Index == 2 {
+			task, time = "cpu", 100
+		}
+		if n.TaskName != task || n.TaskDuration != time {
+			t.Errorf("node %d: got %s/%d, want %s/%d",
+				n.Index, n.TaskName, n.TaskDuration, task, time)
+		}
+	}
+	if n := nodes[3]; n.Index != 4 || n.Depth != 2 || n.ParentIndex != 3 {
+		t.Errorf("unexpected node %+v", n)
+	}
+}
+
+func TestGraphJoin(t *testing.T) {
+	// two stacked diamonds, node 4 and 7 have two parents
+	body := `{"nodes": [{"index": 1, "children": [2, 3]},
+		{"index": 2, "children": [4]}, {"index": 3, "children": [4]},
+		{"index": 4, "children": [5, 6]},
+		{"index": 5, "children": [7]}, {"index": 6, "children": [7]},
+		{"index": 7}]}`
+	tests := []struct {
+		join  string
+		calls int
+	}{
+		{"all", 13},
+		{"once", 7},
+	}
+	for _, tt := range tests {
+		root := &node{Index: 1, Join: tt.join, TaskName: "sleep", TaskDuration: 1}
+		if err := root.setGraph(strings.NewReader(body), 1000); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(walk(root)); got != tt.calls {
+			t.Errorf("join %s: got %d calls, want %d", tt.join, got, tt.calls)
+		}
+	}
+}
+
+func TestGraphSummarize(t *testing.T) {
+	// chain of size nodes
+	chain := func(size int) string {
+		var b strings.Builder
+		b.WriteString(`{"nodes": [`)
+		for i := 1; i <= size; i++ {
+			if i > 1 {
+				b.WriteString(",")
+			}
+			if i < size {
+				fmt.Fprintf(&b, `{"index": %d, "children": [%d]}`, i, i+1)
+			} else {
+				fmt.Fprintf(&b, `{"index": %d}`, i)
+			}
+		}
+		b.WriteString("]}")
+		return b.String()
+	}
+	tests := []struct {
+		url       string
+		size      int
+		summarize bool
+	}{
+		{"/", 10, false},
+		{"/", defaultMaxSize + 1, true},
+		{"/?result=full", defaultMaxSize + 1, false},
+		{"/?size=2000&result=summary", 10, true},
+		{"/?size=2000", 10, false},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		n, err := newNodeFromURL(u, 5000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := n.setGraph(strings.NewReader(chain(tt.size)), 5000); err != nil {
+			t.Fatal(err)
+		}
+		if n.Summarize != tt.summarize {
+			t.Errorf("%s, %d nodes: got summarize %v, want %v",
+				tt.url, tt.size, n.Summarize, tt.summarize)
+		}
+	}
+}
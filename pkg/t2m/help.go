@@ -3,27 +3,85 @@ package t2m
 import (
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 // TODO: update
 
+// help text, %s is replaced by registered topologies
 const helpText = `
 /help           this text
 
 /healthz
     Healthendpoint
 
+/diag
+    Diagnostics e.g. CPU calibration
+
+/leaked
+    GET returns bytes of memory leaked by leak tasks,
+    kept after tasks ended and growing within running tasks
+    DELETE frees memory kept after tasks ended
+
+/plan/<any action>?<parameters>
+    Return request tree of an action without executing it
+    takes the same parameters and request graph as the action
+
+    format:     json|dot
+                output as JSON or graphviz DOT
+                defaults to json
+
 common parameters:
 /<any action>?<parameters>
     size:       positive integer >= 1, number of requests
+                at most MAX_SIZE of server configuration
                 defaults to 1
 
-    topology:   tree|chain|fan
+    result:     full|summary
+                return indices and timings per request node or
+                number of nodes per server and timing statistics
+                defaults to full for size <= 1000, summary otherwise
+                nodes failed without response are listed or counted
+                as failed, their parents respond with 503
+
+    topology:   %s
                 defines topoplogy of request tree
                 defaults to fan
 
+    fanout:     positive integer >= 1, number of children per node
+                in a tree topology
+                defaults to 2
+
+    widths:     comma separated list of positive integers e.g. 10,5,3
+                number of children per node at each depth
+                in a layers topology, size is derived from widths
+
+    seed:       integer, seed of a random topology, time distribution
+                or failure probability
+                defaults to a random value, returned with the result
+
     time:       task duration in milliseconds > 0
+                or distribution of task durations in milliseconds
+                sampled per node using seed:
+                normal(<mean>,<standard deviation>) e.g. normal(50,10)
+                exp(<mean>) e.g. exp(40)
+                pareto(<minimum>,<shape>) e.g. pareto(20,1.5)
+                uniform(<minimum>,<maximum>) e.g. uniform(10,100)
+                sampled durations are limited to one hour
                 defaults to 50
+
+    order:      pre|post|parallel
+                execute task before, after or while calling child nodes
+                defaults to post
+
+    spawn:      serial|parallel|batched:<k>
+                call child nodes one after another, all at once
+                or in batches of k nodes
+                defaults to parallel
+
+    concurrency: positive integer >= 1
+                maximum number of child nodes called at once by a node
+                defaults to CONCURRENCY of server configuration
                 
                 leave actions:
     defaults to none
@@ -36,19 +94,134 @@ common parameters:
     
     /fail
     Terminate TCP connection, do not send http response
+        p:      probability of failure of a node within [0, 1]
+                decided per node using seed
+                defaults to 1
+        at:     leaves|root|depth:<d>|index:<i>
+                select nodes which might fail, d and i are either
+                a single value or a range e.g. depth:2 or index:5-9
+                defaults to all nodes
+                nodes not failing sleep
     
     /crash
     Crash server process
+        mode:   exit|panic|kill|deadlock|hang
+                exit with code, panic on nil pointer dereference,
+                kill with SIGKILL, block all requests forever,
+                never complete request without exiting
+                defaults to exit
+        code:   exit code within 0 ... 255
+                defaults to 1
+        p, at:  select nodes crashing, see /fail
+
+    /status
+    Respond with HTTP status code, parents respond with 503
+        code:   HTTP status code within 400 ... 599 e.g. 429, 502, 504
+                defaults to 500
+        retry:  seconds of Retry-After header
+                defaults to no header
+        body:   text replacing the result in the response body
+                defaults to the result
+        p, at:  select nodes responding with code, see /fail
+
+    /conn
+    Fail on connection level instead of sending a response
+        mode:   rst|fin|hang|truncate|malformed
+                reset connection, close connection, keep connection
+                open without response, close connection after headers
+                and half of the body, respond with invalid HTTP
+                defaults to rst
+        p, at:  select failing nodes, see /fail
+
+    /slow
+    Spend task duration on reading the request or writing the response
+        mode:   write|read
+                write response in chunks spread over task duration
+                or read request body in chunks spread over task duration
+                defaults to write
+        chunk:  bytes per chunk with optional unit
+                defaults to 64
+        p, at:  select slow nodes, all other nodes sleep, see /fail
 
     /cpu
+    Consume CPU
+        load:   fraction of a CPU core within (0, 1]
+                defaults to 0.25
+        cores:  positive integer >= 1 or all, number of cores to load
+                limited by GOMAXPROCS
+                defaults to 1
+        quota:  fraction of cgroup CPU quota e.g. 1.5, replaces load
+                and cores, all CPUs are taken as quota if not limited
+        reports load, cores and utilization i.e. CPU time of process
+        per wall time
 
     /ram
+    Consume RAM
+        bytes:  number of bytes with optional unit
+                k, M, G, T or Ki, Mi, Gi, Ti e.g. 512Mi
+                defaults to 100Mi
+        fraction: fraction of cgroup memory limit e.g. 0.9, replaces bytes
+        mode:   mmap|heap
+                map anonymous memory bypassing the Go runtime
+                or allocate on the Go heap
+                defaults to mmap where supported, heap otherwise
+
+    /io
+    Read, write and sync a file in SCRATCH_DIR of server configuration
+        bytes:  size of file, number of bytes with optional unit
+                defaults to 10Mi
+        block:  bytes per read or write
+                defaults to 64Ki
+        rate:   throughput in bytes per second
+                defaults to 10Mi
+        read:   fraction of blocks read within [0, 1], file is written
+                completely before it is read
+                defaults to 0.5
+
+    /leak
+    Grow memory on the Go heap during task duration
+        rate:   bytes per second with optional unit
+                defaults to 1Mi
+        bytes:  maximum bytes leaked by a single task
+                defaults to unlimited
+        keep:   true|false, keep memory after task ended
+                until freed via DELETE /leaked
+                defaults to false
+
+    /gc
+    Allocate short lived objects on the Go heap, reports
+    GC cycles, total and maximum GC pause in ms
+        rate:   bytes per second with optional unit
+                defaults to 100Mi
+        object: bytes per object with optional unit
+                defaults to 1Ki
     
     example:
         curl "http://<domain:port>/fail?topology=fan&size=1000"
+
+user defined request graph:
+POST /<any action>?<parameters>
+    request body defines graph as JSON document, replacing
+    topology and size. Nodes are indexed 1 ... size, 1 is root node.
+    task and time of nodes default to action and time parameter,
+    task arguments default to query parameters if task does.
+    Nodes may have more than one parent, cycles are not allowed.
+
+    join:       all|once
+                nodes with more than one parent are called
+                by all parents or once by the parent with lowest index
+                defaults to all
+
+    example:
+        curl -X POST "http://<domain:port>/sleep?time=20" -d '{"nodes": [
+            {"index": 1, "children": [2, 3]},
+            {"index": 2, "task": "cpu", "time": 100},
+            {"index": 3, "children": [4]},
+            {"index": 4}
+        ]}'
         
 `
 
 func handleHelp(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintln(w, helpText)
+	fmt.Fprintf(w, helpText, strings.Join(topologyNames(), "|"))
 }
@@ -0,0 +1,108 @@
+package t2m
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// memory leaked by leak tasks
+var leaks = struct {
+	sync.Mutex
+	// memory kept after leak tasks ended, until reset
+	kept [][]byte
+	// bytes kept
+	keptBytes uint64
+	// bytes held by running leak tasks
+	growing uint64
+}{}
+
+// interval of memory growth of leak tasks
+const leakInterval = 100 * time.Millisecond
+
+// allocate memory and write to every page so that it is resident
+func leakChunk(bytes uint64) []byte {
+	mem := make([]byte, bytes)
+	touch(mem)
+	return mem
+}
+
+// grow memory until stopped
+// rate: bytes per sec
+// max: upper bound of bytes leaked by this task, 0 == unlimited
+// keep: keep memory after the task ended until reset
+func leak(rate, max uint64, keep bool) tasklet {
+	return func(l *log.Logger, done <-chan struct{}, r taskReport) {
+		l.Printf("Leak %d bytes per sec\n", rate)
+		var chunks [][]byte
+		var bytes uint64
+		ticker := time.NewTicker(leakInterval)
+		defer ticker.Stop()
+		start := time.Now()
+		for end := false; !end; {
+			select {
+			case <-done:
+				end = true
+			case <-ticker.C:
+				// grow by elapsed time to catch up on delayed ticks
+				due := uint64(float64(rate) * time.Since(start).Seconds())
+				if max > 0 && due > max {
+					due = max
+				}
+				if due <= bytes {
+					continue
+				}
+				chunks = append(chunks, leakChunk(due-bytes))
+				leaks.Lock()
+				leaks.growing += due - bytes
+				leaks.Unlock()
+				bytes = due
+			}
+		}
+
+		leaks.Lock()
+		leaks.growing -= bytes
+		if keep {
+			leaks.kept = append(leaks.kept, chunks...)
+			leaks.keptBytes += bytes
+		}
+		r["bytes"] = bytes
+		r["kept"] = leaks.keptBytes
+		leaks.Unlock()
+		if keep {
+			l.Printf("Keep %d leaked bytes\n", bytes)
+		} else {
+			l.Printf("Free %d leaked bytes\n", bytes)
+		}
+	}
+}
+
+// Leaked endpoint
+// GET returns bytes leaked by leak tasks
+// DELETE frees memory kept after leak tasks ended
+func (s *Server) handleLeaked(w http.ResponseWriter, r *http.Request) {
+	leaks.Lock()
+	if r.Method == "DELETE" {
+		leaks.kept = nil
+		leaks.keptBytes = 0
+	}
+	d := struct {
+		Server  string `json:"server"`
+		Kept    uint64 `json:"kept"`
+		Growing uint64 `json:"growing"`
+	}{s.id.String(), leaks.keptBytes, leaks.growing}
+	leaks.Unlock()
+	if r.Method == "DELETE" {
+		// return memory to OS instead of waiting for the scavenger
+		debug.FreeOSMemory()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	e := json.NewEncoder(w)
+	if err := e.Encode(d); err != nil {
+		panic(err)
+	}
+}
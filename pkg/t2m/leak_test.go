@@ -0,0 +1,30 @@
+package t2m
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeak(t *testing.T) {
+	defer func() {
+		leaks.kept, leaks.keptBytes = nil, 0
+	}()
+	r := runTasklet(leak(10*1024*1024, 1024*1024, false), 300*time.Millisecond)
+	if r["bytes"].(uint64) != 1024*1024 {
+		t.Errorf("leaked %v bytes, want %d", r["bytes"], 1024*1024)
+	}
+	if leaks.keptBytes != 0 || leaks.growing != 0 {
+		t.Errorf("kept %d, growing %d after task without keep",
+			leaks.keptBytes, leaks.growing)
+	}
+
+	r = runTasklet(leak(1024*1024, 0, true), 250*time.Millisecond)
+	b := r["bytes"].(uint64)
+	if b == 0 || b > 512*1024 {
+		t.Errorf("leaked %d bytes, want about %d", b, 256*1024)
+	}
+	if leaks.keptBytes != b || leaks.growing != 0 {
+		t.Errorf("kept %d, growing %d, want %d, 0",
+			leaks.keptBytes, leaks.growing, b)
+	}
+}
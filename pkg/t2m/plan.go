@@ -0,0 +1,126 @@
+package t2m
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// planNode is a request node as planned i.e. before it is executed
+type planNode struct {
+	Index    int         `json:"index"`
+	Parent   int         `json:"parent"`
+	Depth    int         `json:"depth"`
+	Task     string      `json:"task"`
+	Args     taskArgs    `json:"args,omitempty"`
+	Time     float64     `json:"time"`
+	Children []*planNode `json:"children,omitempty"`
+}
+
+// plan is the request tree computed for a root node
+// without spawning any requests
+type plan struct {
+	Topology string     `json:"topology"`
+	Params   url.Values `json:"params,omitempty"`
+	Seed     int64      `json:"seed,omitempty"`
+	// distribution of task durations
+	Time string `json:"time,omitempty"`
+	// number of request nodes
+	Size int `json:"size"`
+	// number of requests, differs from size if nodes are called more than once
+	Calls int `json:"calls"`
+	// maximum depth of request tree
+	Depth int       `json:"depth"`
+	Root  *planNode `json:"root"`
+}
+
+// compute plan of request tree with root node n
+func newPlan(n *node) *plan {
+	p := &plan{
+		Topology: n.Topology,
+		Params:   n.Params,
+		Size:     n.Size,
+		Time:     n.TimeDistribution,
+	}
+	if n.hasSeed() {
+		p.Seed = n.Seed
+	}
+	var expand func(n *node) *planNode
+	expand = func(n *node) *planNode {
+		p.Calls++
+		if n.Depth > p.Depth {
+			p.Depth = n.Depth
+		}
+		pn := &planNode{
+			Index:  n.Index,
+			Parent: n.ParentIndex,
+			Depth:  n.Depth,
+			Task:   n.TaskName,
+			Args:   n.TaskArgs,
+			Time:   ms(n.taskDuration()),
+		}
+		for _, c := range n.children() {
+			pn.Children = append(pn.Children, expand(c))
+		}
+		return pn
+	}
+	p.Root = expand(n)
+	return p
+}
+
+// write plan in graphviz DOT format
+// nodes are identified by order of calls as nodes might be called twice
+func (p *plan) writeDot(w io.Writer) {
+	fmt.Fprintln(w, "digraph t2m {")
+	id := 0
+	var write func(pn *planNode) int
+	write = func(pn *planNode) int {
+		id++
+		nid := id
+		fmt.Fprintf(w, "  n%d [label=\"%d\\n%s\"];\n", nid, pn.Index, pn.Task)
+		for _, c := range pn.Children {
+			fmt.Fprintf(w, "  n%d -> n%d;\n", nid, write(c))
+		}
+		return nid
+	}
+	write(p.Root)
+	fmt.Fprintln(w, "}")
+}
+
+// Plan endpoint, takes the same action, parameters and request graph
+// as external requests but returns the request tree instead of executing it
+func (s *Server) handlePlan(w http.ResponseWriter, r *http.Request) {
+	u := *r.URL
+	u.Path = strings.TrimPrefix(u.Path, "/plan")
+	u.RawPath = ""
+	n, err := newNodeFromURL(&u, s.maxSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Method == "POST" {
+		r.Body = http.MaxBytesReader(w, r.Body, maxGraphBytes(s.maxSize))
+		if err := n.setGraph(r.Body, s.maxSize); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	p := newPlan(n)
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		e := json.NewEncoder(w)
+		if err := e.Encode(p); err != nil {
+			panic(err)
+		}
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		p.writeDot(w)
+	default:
+		http.Error(w, errQueryParameter.Error(), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,34 @@
+package t2m
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		topology string
+		size     int
+		depth    int
+	}{
+		{"fan", 10, 1},
+		{"chain", 10, 9},
+		{"tree", 10, 3},
+	}
+	for _, tt := range tests {
+		n := &node{Topology: tt.topology, Index: 1, Size: tt.size,
+			Params: url.Values{"fanout": {"2"}}}
+		p := newPlan(n)
+		if p.Calls != tt.size || p.Depth != tt.depth {
+			t.Errorf("%s: got %d calls with depth %d, want %d with depth %d",
+				tt.topology, p.Calls, p.Depth, tt.size, tt.depth)
+		}
+		b := &bytes.Buffer{}
+		p.writeDot(b)
+		if edges := strings.Count(b.String(), "->"); edges != tt.size-1 {
+			t.Errorf("%s: got %d edges, want %d", tt.topology, edges, tt.size-1)
+		}
+	}
+}
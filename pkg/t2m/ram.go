@@ -0,0 +1,84 @@
+package t2m
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+)
+
+var errAllocMode = errors.New("Allocation mode not supported")
+
+// allocator provides memory outside of regular Go objects' lifetime
+// i.e. memory is held until it is freed explicitly
+type allocator interface {
+	alloc(bytes int) ([]byte, error)
+	free(mem []byte) error
+}
+
+// allocator for mode: mmap or heap, "" == default of platform
+func newAllocator(mode string) (allocator, error) {
+	switch mode {
+	case "":
+		if mmapSupported {
+			return mmapAllocator{}, nil
+		}
+		return heapAllocator{}, nil
+	case "mmap":
+		if mmapSupported {
+			return mmapAllocator{}, nil
+		}
+		return nil, errAllocMode
+	case "heap":
+		return heapAllocator{}, nil
+	}
+	return nil, errAllocMode
+}
+
+// heapAllocator allocates memory on the Go heap,
+// freed memory is released by the garbage collector
+type heapAllocator struct{}
+
+func (heapAllocator) alloc(bytes int) ([]byte, error) {
+	if bytes < 0 {
+		return nil, errAllocMode
+	}
+	return make([]byte, bytes), nil
+}
+
+func (heapAllocator) free(mem []byte) error {
+	return nil
+}
+
+// write to pages of mem so that they are resident
+func touch(mem []byte) {
+	inc := os.Getpagesize() * 100 / 125
+	for i := 0; i < len(mem); i += inc {
+		mem[i] = 1
+	}
+}
+
+// consume RAM until stopped
+// s: RAM in Bytes
+// a: allocator of RAM
+func ram(s uint64, a allocator) tasklet {
+	return func(l *log.Logger, done <-chan struct{}, r taskReport) {
+		l.Printf("Consume %d bytes of RAM\n", s)
+		r["bytes"] = s
+		mem, err := a.alloc(int(s))
+		if err != nil {
+			l.Panic(err)
+		}
+		defer a.free(mem)
+		for end := false; !end; {
+			select {
+			case <-done:
+				end = true
+			default:
+				touch(mem)
+				time.Sleep(time.Millisecond)
+			}
+		}
+		l.Println("Free RAM")
+	}
+}
@@ -0,0 +1,16 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package t2m
+
+const mmapSupported = false
+
+// mmapAllocator is not available on this platform
+type mmapAllocator struct{}
+
+func (mmapAllocator) alloc(bytes int) ([]byte, error) {
+	return nil, errAllocMode
+}
+
+func (mmapAllocator) free(mem []byte) error {
+	return errAllocMode
+}
@@ -0,0 +1,20 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package t2m
+
+import "syscall"
+
+const mmapSupported = true
+
+// mmapAllocator maps anonymous memory bypassing the Go runtime
+type mmapAllocator struct{}
+
+func (mmapAllocator) alloc(bytes int) ([]byte, error) {
+	return syscall.Mmap(-1, 0, bytes,
+		syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_ANON|syscall.MAP_PRIVATE)
+}
+
+func (mmapAllocator) free(mem []byte) error {
+	return syscall.Munmap(mem)
+}
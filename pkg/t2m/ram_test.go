@@ -0,0 +1,64 @@
+package t2m
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewAllocator(t *testing.T) {
+	mmapErr := errAllocMode
+	if mmapSupported {
+		mmapErr = nil
+	}
+	tests := []struct {
+		mode string
+		err  error
+	}{
+		{"", nil},
+		{"heap", nil},
+		{"mmap", mmapErr},
+		{"malloc", errAllocMode},
+	}
+	for _, tt := range tests {
+		if _, err := newAllocator(tt.mode); err != tt.err {
+			t.Errorf("%q: got %v, want %v", tt.mode, err, tt.err)
+		}
+	}
+}
+
+func TestAllocators(t *testing.T) {
+	for _, mode := range []string{"heap", "mmap"} {
+		a, err := newAllocator(mode)
+		if err != nil {
+			continue // not supported on this platform
+		}
+		const size = 1024 * 1024
+		mem, err := a.alloc(size)
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		if len(mem) != size {
+			t.Errorf("%s: got %d bytes, want %d", mode, len(mem), size)
+		}
+		touch(mem)
+		if mem[0] != 1 {
+			t.Errorf("%s: pages not touched", mode)
+		}
+		if err := a.free(mem); err != nil {
+			t.Errorf("%s: %v", mode, err)
+		}
+	}
+}
+
+func TestRAM(t *testing.T) {
+	for _, mode := range []string{"heap", "mmap"} {
+		a, err := newAllocator(mode)
+		if err != nil {
+			continue
+		}
+		r := runTasklet(ram(4*1024*1024, a), 20*time.Millisecond)
+		if r["bytes"] != uint64(4*1024*1024) {
+			t.Errorf("%s: got %v bytes", mode, r["bytes"])
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package t2m
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// responder writes the response of a request node
+// instead of the aggregated result encoded in JSON
+// statusCode and body are those of the aggregated result
+type responder func(w http.ResponseWriter, statusCode int, body []byte)
+
+// create responder of task name with arguments a and task duration d
+// return nil if task does not affect the response
+// return errTaskArgument on invalid arguments
+func createResponder(name string, a taskArgs, d time.Duration) (responder, error) {
+	switch name {
+	case "status":
+		code, err := a.int("code", http.StatusInternalServerError)
+		if err != nil || code < 400 || code > 599 {
+			return nil, errTaskArgument
+		}
+		retry, err := a.int("retry", 0)
+		if err != nil || retry < 0 {
+			return nil, errTaskArgument
+		}
+		body, custom := a["body"]
+		return status(code, retry, body, custom), nil
+	case "conn":
+		switch m := a["mode"]; m {
+		case "", "rst", "fin", "hang", "truncate", "malformed":
+			if m == "" {
+				m = "rst"
+			}
+			return conn(m), nil
+		}
+		return nil, errTaskArgument
+	case "slow":
+		mode, chunk, err := slowArgs(a)
+		if err != nil {
+			return nil, err
+		}
+		if mode == "write" {
+			return dribble(chunk, d), nil
+		}
+	}
+	return nil, nil
+}
+
+// respond with status code
+// retry: seconds of Retry-After header, 0 == no header
+// body: replaces the aggregated result if custom
+func status(code, retry int, body string, custom bool) responder {
+	return func(w http.ResponseWriter, statusCode int, result []byte) {
+		if retry > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(retry))
+		}
+		if !custom {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			w.Write(result)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(code)
+		w.Write([]byte(body))
+	}
+}
+
+// fail on connection level
+// rst: reset connection
+// fin: close connection without response
+// hang: keep connection open without response until closed by client
+// truncate: close connection after headers and half of the body
+// malformed: respond with an invalid status line and headers
+func conn(mode string) responder {
+	return func(w http.ResponseWriter, statusCode int, body []byte) {
+		h, ok := w.(http.Hijacker)
+		if !ok {
+			panic(http.ErrAbortHandler)
+		}
+		c, rw, err := h.Hijack()
+		if err != nil {
+			panic(err)
+		}
+		defer c.Close()
+		switch mode {
+		case "rst":
+			if tc, ok := c.(*net.TCPConn); ok {
+				// discard unsent data and send RST on close
+				tc.SetLinger(0)
+			}
+		case "fin":
+		case "hang":
+			io.Copy(ioutil.Discard, c)
+		case "truncate":
+			fmt.Fprintf(rw, "HTTP/1.1 %d %s\r\n", statusCode, http.StatusText(statusCode))
+			fmt.Fprintf(rw, "Content-Type: application/json\r\n")
+			fmt.Fprintf(rw, "Content-Length: %d\r\n\r\n", len(body))
+			rw.Write(body[:len(body)/2])
+			rw.Flush()
+		case "malformed":
+			fmt.Fprintf(rw, "HTTP/1.1 2OO OK\r\nContent-Length -1\r\n\r\n")
+			rw.Flush()
+		}
+	}
+}
+
+// mode and chunk size of slow task
+func slowArgs(a taskArgs) (string, int, error) {
+	mode := a["mode"]
+	switch mode {
+	case "":
+		mode = "write"
+	case "write", "read":
+	default:
+		return "", 0, errTaskArgument
+	}
+	chunk, err := a.bytes("chunk", 64)
+	if err != nil || chunk == 0 || chunk > 1024*1024 {
+		return "", 0, errTaskArgument
+	}
+	return mode, int(chunk), nil
+}
+
+// write response in chunks spread over duration d
+func dribble(chunk int, d time.Duration) responder {
+	return func(w http.ResponseWriter, statusCode int, body []byte) {
+		f, ok := w.(http.Flusher)
+		if !ok {
+			panic(http.ErrAbortHandler)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(statusCode)
+		f.Flush()
+		delay := d / time.Duration((len(body)+chunk-1)/chunk)
+		for len(body) > 0 {
+			time.Sleep(delay)
+			c := chunk
+			if c > len(body) {
+				c = len(body)
+			}
+			if _, err := w.Write(body[:c]); err != nil {
+				return // e.g. closed by client
+			}
+			f.Flush()
+			body = body[c:]
+		}
+	}
+}
+
+// slowReader reads chunks of r spread over a duration
+type slowReader struct {
+	r     io.ReadCloser
+	chunk int
+	size  int64
+	d     time.Duration
+	start time.Time
+	read  int64 // bytes read so far
+}
+
+// read r of size bytes in chunks spread over duration d
+// size <= 0: unknown size, e.g. chunked request body,
+// reading is delayed until d passed
+func newSlowReader(r io.ReadCloser, size int64, chunk int, d time.Duration) io.ReadCloser {
+	return &slowReader{r: r, chunk: chunk, size: size, d: d, start: time.Now()}
+}
+
+func (sr *slowReader) Read(p []byte) (int, error) {
+	if len(p) > sr.chunk {
+		p = p[:sr.chunk]
+	}
+	n, err := sr.r.Read(p)
+	if n > 0 {
+		sr.read += int64(n)
+		// pace against deadline instead of sleeping per chunk
+		// i.e. time spent on reading is not added to d
+		due := sr.d
+		if sr.size > 0 && sr.read < sr.size {
+			due = time.Duration(float64(sr.d) * float64(sr.read) / float64(sr.size))
+		}
+		time.Sleep(time.Until(sr.start.Add(due)))
+	}
+	return n, err
+}
+
+func (sr *slowReader) Close() error {
+	return sr.r.Close()
+}
+
+// duration of writing the response of n slowly
+// 0 == written at once
+func (n *node) slowWrite() time.Duration {
+	if n.TaskName != "slow" {
+		return 0
+	}
+	mode, _, err := slowArgs(n.TaskArgs)
+	if err != nil || mode != "write" || !n.injected() {
+		return 0
+	}
+	return n.taskDuration()
+}
+
+// duration and chunk size of reading the request body of n slowly
+// 0 == read at once
+func (n *node) slowRead() (time.Duration, int) {
+	if n.TaskName != "slow" {
+		return 0, 0
+	}
+	mode, chunk, err := slowArgs(n.TaskArgs)
+	if err != nil || mode != "read" || !n.injected() {
+		return 0, 0
+	}
+	return n.taskDuration(), chunk
+}
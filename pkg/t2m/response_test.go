@@ -0,0 +1,216 @@
+package t2m
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStatusResponder(t *testing.T) {
+	tests := []struct {
+		args   taskArgs
+		code   int
+		retry  string
+		body   string
+		ctype  string
+		argErr bool
+	}{
+		{taskArgs{}, 500, "", "{}\n", "application/json", false},
+		{taskArgs{"code": "429", "retry": "30"}, 429, "30", "{}\n", "application/json", false},
+		{taskArgs{"code": "502", "body": "bad gateway"}, 502, "", "bad gateway", "text/plain; charset=utf-8", false},
+		{taskArgs{"code": "200"}, 0, "", "", "", true},
+		{taskArgs{"retry": "-1"}, 0, "", "", "", true},
+	}
+	for _, tt := range tests {
+		rsp, err := createResponder("status", tt.args, 0)
+		if tt.argErr {
+			if err != errTaskArgument {
+				t.Errorf("%v: got %v, want %v", tt.args, err, errTaskArgument)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rsp(w, http.StatusOK, []byte("{}\n"))
+		if w.Code != tt.code || w.Header().Get("Retry-After") != tt.retry ||
+			w.Body.String() != tt.body || w.Header().Get("Content-Type") != tt.ctype {
+			t.Errorf("%v: got %d %q %q %q", tt.args, w.Code,
+				w.Header().Get("Retry-After"), w.Body, w.Header().Get("Content-Type"))
+		}
+	}
+	if rsp, err := createResponder("sleep", nil, 0); rsp != nil || err != nil {
+		t.Errorf("sleep: got %v, %v", rsp, err)
+	}
+}
+
+func TestConnResponder(t *testing.T) {
+	isTimeout := func(err error) bool {
+		e, ok := err.(net.Error)
+		return ok && e.Timeout()
+	}
+	tests := []struct {
+		mode string
+		// true if error of get (no response) or of reading body is expected
+		getErr  func(err error) bool
+		readErr func(err error) bool
+	}{
+		{"rst", func(err error) bool { return errors.Is(err, syscall.ECONNRESET) }, nil},
+		{"fin", func(err error) bool { return errors.Is(err, io.EOF) }, nil},
+		{"hang", isTimeout, nil},
+		{"truncate", nil, func(err error) bool { return err == io.ErrUnexpectedEOF }},
+		{"malformed", func(err error) bool {
+			return err != nil && strings.Contains(err.Error(), "malformed HTTP")
+		}, nil},
+	}
+	for _, tt := range tests {
+		rsp, err := createResponder("conn", taskArgs{"mode": tt.mode}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				rsp(w, http.StatusOK, []byte("{\"nodes\": []}\n"))
+			}))
+		client := &http.Client{Timeout: 200 * time.Millisecond}
+		resp, err := client.Get(ts.URL)
+		switch {
+		case tt.getErr != nil:
+			if !tt.getErr(err) {
+				t.Errorf("%s: got error %v", tt.mode, err)
+			}
+			if resp != nil {
+				t.Errorf("%s: got status %s", tt.mode, resp.Status)
+				resp.Body.Close()
+			}
+		case err != nil:
+			t.Errorf("%s: got error %v", tt.mode, err)
+		default:
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("%s: got status %s", tt.mode, resp.Status)
+			}
+			b, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if !tt.readErr(err) {
+				t.Errorf("%s: got error %v reading body %q", tt.mode, err, b)
+			}
+		}
+		ts.CloseClientConnections()
+		ts.Close()
+	}
+	if _, err := createResponder("conn", taskArgs{"mode": "slow"}, 0); err != errTaskArgument {
+		t.Errorf("got %v, want %v", err, errTaskArgument)
+	}
+}
+
+func TestDribbleResponder(t *testing.T) {
+	rsp, err := createResponder("slow", taskArgs{"chunk": "10"}, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := bytes.Repeat([]byte("x"), 95)
+	w := httptest.NewRecorder()
+	start := time.Now()
+	rsp(w, http.StatusServiceUnavailable, body)
+	if d := time.Since(start); d < 90*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("written within %s, want about 100ms", d)
+	}
+	if w.Code != http.StatusServiceUnavailable || !bytes.Equal(w.Body.Bytes(), body) {
+		t.Errorf("got %d %q", w.Code, w.Body)
+	}
+	if rsp, err := createResponder("slow", taskArgs{"mode": "read"}, 0); rsp != nil || err != nil {
+		t.Errorf("read: got %v, %v", rsp, err)
+	}
+	if _, err := createResponder("slow", taskArgs{"chunk": "0"}, 0); err != errTaskArgument {
+		t.Errorf("got %v, want %v", err, errTaskArgument)
+	}
+}
+
+func TestSlowReader(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 100)
+	tests := []struct {
+		name string
+		size int64
+	}{
+		{"known size", 100},
+		{"unknown size", -1}, // e.g. chunked body
+	}
+	for _, tt := range tests {
+		r := newSlowReader(ioutil.NopCloser(bytes.NewReader(body)), tt.size, 10, 100*time.Millisecond)
+		start := time.Now()
+		b, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(b, body) {
+			t.Fatalf("%s: got %q, %v", tt.name, b, err)
+		}
+		if d := time.Since(start); d < 90*time.Millisecond || d > 300*time.Millisecond {
+			t.Errorf("%s: read within %s, want about 100ms", tt.name, d)
+		}
+	}
+}
+
+func TestSlowTimings(t *testing.T) {
+	ts, _ := newTestServer(t, nil)
+	graph := `{"nodes": [{"index": 1}]}`
+	tests := []struct {
+		method  string
+		query   string
+		index   int
+		chunked bool // request body of unknown length
+	}{
+		{"GET", "/slow?time=200&chunk=8", 1, false},
+		// nothing to read, sleep instead
+		{"GET", "/slow?mode=read&time=200", 1, false},
+		{"GET", "/slow?mode=read&time=200&chunk=8&size=2&at=index:2", 2, false},
+		{"POST", "/slow?mode=read&time=200&chunk=2", 1, false},
+		{"POST", "/slow?mode=read&time=200&chunk=2", 1, true},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		var body io.Reader = strings.NewReader(graph)
+		if tt.chunked {
+			// hide length from http.NewRequest
+			body = io.MultiReader(body)
+		}
+		req, err := http.NewRequest(tt.method, ts.URL+tt.query, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &result{}
+		err = json.NewDecoder(resp.Body).Decode(r)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(start); d < 200*time.Millisecond {
+			t.Errorf("%s %s: took %s, want at least 200ms", tt.method, tt.query, d)
+		}
+		found := false
+		for _, nr := range r.Nodes {
+			if nr.Index != tt.index {
+				continue
+			}
+			found = true
+			if nr.Task < 180 || nr.Task > 400 || nr.Elapsed < nr.Task {
+				t.Errorf("%s %s: node %d task %.1fms, elapsed %.1fms, want about 200ms",
+					tt.method, tt.query, nr.Index, nr.Task, nr.Elapsed)
+			}
+		}
+		if !found {
+			t.Errorf("%s %s: no result of node %d", tt.method, tt.query, tt.index)
+		}
+	}
+}
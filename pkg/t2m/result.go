@@ -0,0 +1,223 @@
+package t2m
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// timings of a single request node in ms
+type nodeResult struct {
+	Index  int `json:"index"`
+	Parent int `json:"parent"`
+	Depth  int `json:"depth"`
+	// time from receiving the request until sending the response
+	Elapsed float64 `json:"elapsed"`
+	// time spent calling child nodes
+	Children float64 `json:"children"`
+	// time spent executing the task
+	Task float64 `json:"task"`
+	// duration of task i.e. time or sampled from time distribution
+	Time float64 `json:"time,omitempty"`
+	// values reported by the task
+	Report taskReport `json:"report,omitempty"`
+}
+
+// result of a request node merged with the results of its sub tree
+// Results are either kept per request node or summarized,
+// the latter keeps the size of results independent of the tree size.
+type result struct {
+	// Seed of a random topology, only set by root node
+	Seed *int64 `json:"seed,omitempty"`
+	// Indices of request nodes per server
+	Servers map[string]string `json:"servers,omitempty"`
+	// Timings per request node
+	Nodes []nodeResult `json:"nodes,omitempty"`
+	// Summary of request nodes
+	Summary *summary `json:"summary,omitempty"`
+	// Indices of request nodes failed without result
+	Failed []int `json:"failed,omitempty"`
+}
+
+// create result of a single request node
+// running on server with given id
+func newResult(id string, nr nodeResult, summarize bool) *result {
+	if summarize {
+		s := &summary{
+			Nodes:    1,
+			Depth:    nr.Depth,
+			Servers:  map[string]int{id: 1},
+			Elapsed:  newStats(),
+			Children: newStats(),
+			Task:     newStats(),
+		}
+		s.Elapsed.add(nr.Elapsed)
+		s.Children.add(nr.Children)
+		s.Task.add(nr.Task)
+		return &result{Summary: s}
+	}
+	return &result{
+		Servers: map[string]string{id: fmt.Sprintf("%04d", nr.Index)},
+		Nodes:   []nodeResult{nr},
+	}
+}
+
+// create result of a child node with given index
+// which failed without result
+func newFailedResult(index int, summarize bool) *result {
+	if summarize {
+		return &result{Summary: &summary{Failed: 1}}
+	}
+	return &result{Failed: []int{index}}
+}
+
+// merge result of a child node into r
+func (r *result) merge(c *result) {
+	for k, v := range c.Servers {
+		if r.Servers[k] == "" {
+			r.Servers[k] = v
+		} else {
+			// merge values
+			r.Servers[k] = fmt.Sprintf("%s %s", r.Servers[k], v)
+		}
+	}
+	r.Nodes = append(r.Nodes, c.Nodes...)
+	r.Failed = append(r.Failed, c.Failed...)
+	if c.Summary != nil && r.Summary != nil {
+		r.Summary.merge(c.Summary)
+	}
+}
+
+// summary of request nodes of a (sub) tree
+type summary struct {
+	// number of request nodes
+	Nodes int `json:"nodes"`
+	// maximum depth of request nodes
+	Depth int `json:"depth"`
+	// number of request nodes failed without result
+	Failed int `json:"failed"`
+	// number of request nodes per server
+	Servers map[string]int `json:"servers"`
+	// statistics of node timings
+	Elapsed  *stats `json:"elapsed"`
+	Children *stats `json:"children"`
+	Task     *stats `json:"task"`
+}
+
+// merge summary of a child node into s
+func (s *summary) merge(c *summary) {
+	s.Nodes += c.Nodes
+	s.Failed += c.Failed
+	if c.Depth > s.Depth {
+		s.Depth = c.Depth
+	}
+	for k, v := range c.Servers {
+		s.Servers[k] += v
+	}
+	s.Elapsed.merge(c.Elapsed)
+	s.Children.merge(c.Children)
+	s.Task.merge(c.Task)
+}
+
+// growth factor of histogram buckets i.e. precision of percentiles
+const bucketGrowth = 1.05
+
+// smallest value distinguished by histogram buckets
+const bucketMin = 0.001
+
+// statistics of durations in ms
+// which can be merged without keeping all values
+type stats struct {
+	Count int     `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	// histogram with logarithmic buckets,
+	// bucket i counts values within [bucketMin*g^i, bucketMin*g^(i+1))
+	Buckets map[int]int `json:"buckets"`
+}
+
+func newStats() *stats {
+	return &stats{Buckets: make(map[int]int)}
+}
+
+// add a single value
+func (s *stats) add(v float64) {
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Count++
+	s.Sum += v
+	b := 0
+	if v > bucketMin {
+		b = int(math.Log(v/bucketMin) / math.Log(bucketGrowth))
+	}
+	s.Buckets[b]++
+}
+
+// merge statistics c into s
+func (s *stats) merge(c *stats) {
+	if c == nil || c.Count == 0 {
+		return
+	}
+	if s.Count == 0 || c.Min < s.Min {
+		s.Min = c.Min
+	}
+	if s.Count == 0 || c.Max > s.Max {
+		s.Max = c.Max
+	}
+	s.Count += c.Count
+	s.Sum += c.Sum
+	for b, n := range c.Buckets {
+		s.Buckets[b] += n
+	}
+}
+
+// estimate percentile p (0 ... 100) from histogram
+func (s *stats) percentile(p float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	bs := make([]int, 0, len(s.Buckets))
+	for b := range s.Buckets {
+		bs = append(bs, b)
+	}
+	sort.Ints(bs)
+	rank := int(math.Ceil(p / 100 * float64(s.Count)))
+	n := 0
+	for _, b := range bs {
+		n += s.Buckets[b]
+		if n >= rank {
+			// geometric center of bucket
+			v := bucketMin * math.Pow(bucketGrowth, float64(b)+0.5)
+			return math.Max(s.Min, math.Min(s.Max, v))
+		}
+	}
+	return s.Max
+}
+
+// MarshalJSON adds mean and percentiles derived from s
+func (s *stats) MarshalJSON() ([]byte, error) {
+	type plain stats
+	mean := 0.0
+	if s.Count > 0 {
+		mean = s.Sum / float64(s.Count)
+	}
+	return json.Marshal(struct {
+		*plain
+		Mean float64 `json:"mean"`
+		P50  float64 `json:"p50"`
+		P90  float64 `json:"p90"`
+		P99  float64 `json:"p99"`
+	}{(*plain)(s), mean, s.percentile(50), s.percentile(90), s.percentile(99)})
+}
+
+// duration in ms
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
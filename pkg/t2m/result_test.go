@@ -0,0 +1,57 @@
+package t2m
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestStatsMerge(t *testing.T) {
+	// merging partial statistics equals statistics of all values
+	all, parts := newStats(), []*stats{newStats(), newStats(), newStats()}
+	for i := 1; i <= 1000; i++ {
+		v := float64(i) / 10
+		all.add(v)
+		parts[i%3].add(v)
+	}
+	merged := newStats()
+	for _, p := range parts {
+		// statistics pass JSON encoding between request nodes
+		b, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := &stats{}
+		if err := json.Unmarshal(b, s); err != nil {
+			t.Fatal(err)
+		}
+		merged.merge(s)
+	}
+	if merged.Count != 1000 || merged.Min != 0.1 || merged.Max != 100 ||
+		math.Abs(merged.Sum-all.Sum) > 1e-6 {
+		t.Errorf("got %+v, want %+v", merged, all)
+	}
+	for _, p := range []float64{50, 90, 99} {
+		want := p
+		got := merged.percentile(p)
+		if math.Abs(got-want)/want > bucketGrowth-1 {
+			t.Errorf("p%.0f: got %f, want %f", p, got, want)
+		}
+	}
+}
+
+func TestSummaryMerge(t *testing.T) {
+	r := newResult("a", nodeResult{Index: 1, Elapsed: 10}, true)
+	r.merge(newResult("b", nodeResult{Index: 2, Depth: 1, Elapsed: 5}, true))
+	r.merge(newResult("a", nodeResult{Index: 3, Depth: 2, Elapsed: 1}, true))
+	s := r.Summary
+	if s.Nodes != 3 || s.Depth != 2 || s.Servers["a"] != 2 || s.Servers["b"] != 1 {
+		t.Errorf("unexpected summary %+v", s)
+	}
+	if s.Elapsed.Count != 3 || s.Elapsed.Min != 1 || s.Elapsed.Max != 10 {
+		t.Errorf("unexpected elapsed %+v", s.Elapsed)
+	}
+	if r.Nodes != nil || r.Servers != nil {
+		t.Errorf("summarized result should not contain nodes")
+	}
+}
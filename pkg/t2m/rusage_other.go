@@ -0,0 +1,10 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package t2m
+
+import "time"
+
+// CPU time of this process is not available
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
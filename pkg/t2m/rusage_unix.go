@@ -0,0 +1,17 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package t2m
+
+import (
+	"syscall"
+	"time"
+)
+
+// CPU time (user and system) consumed by this process
+func processCPUTime() (time.Duration, bool) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, false
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano()), true
+}
@@ -1,11 +1,14 @@
 package t2m
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -29,6 +32,16 @@ func requestLogger(next http.Handler) http.Handler {
 		})
 }
 
+// hold serving lock while serving requests
+func lockServing(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			serving.RLock()
+			defer serving.RUnlock()
+			next.ServeHTTP(w, r)
+		})
+}
+
 // Server the HTTP server
 type Server struct {
 	// Unique ID of this server
@@ -37,10 +50,60 @@ type Server struct {
 	// Target URL for subsequent requests
 	targetURL string // balanced as binary tree. I.e. each request will at most create 2
 	// sub requests. Each request is marked by a node.
+	// Client used for subsequent requests
+	client *http.Client
+	// Default number of child nodes called concurrently by a request node
+	concurrency int
+	// Maximum number of request nodes of a request tree
+	maxSize int
+	// Interval of CPU calibration, 0 == calibrate on start only
+	calibrationInterval time.Duration
+	// Directory for files written by tasks
+	scratchDir string
+}
+
+// ServerOption configures a server
+type ServerOption func(*Server)
+
+// WithConcurrency sets the default number of child nodes
+// called concurrently by a request node
+func WithConcurrency(n int) ServerOption {
+	return func(s *Server) {
+		if n > 0 {
+			s.concurrency = n
+		}
+	}
+}
+
+// WithMaxSize sets the maximum number of request nodes of a request tree
+func WithMaxSize(n int) ServerOption {
+	return func(s *Server) {
+		if n > 0 {
+			s.maxSize = n
+		}
+	}
+}
+
+// WithCalibrationInterval sets the interval of repeated CPU calibration
+// The CPU is always calibrated on start.
+func WithCalibrationInterval(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.calibrationInterval = d
+	}
+}
+
+// WithScratchDir sets the directory for files written by tasks
+// defaults to the temporary directory of the OS
+func WithScratchDir(dir string) ServerOption {
+	return func(s *Server) {
+		if dir != "" {
+			s.scratchDir = dir
+		}
+	}
 }
 
 // NewServer create a new server
-func NewServer(addr string, targetURL string) *Server {
+func NewServer(addr string, targetURL string, opts ...ServerOption) *Server {
 	r := mux.NewRouter()
 
 	// Just use defaults
@@ -48,22 +111,55 @@ func NewServer(addr string, targetURL string) *Server {
 		id: uuid.New(),
 		server: &http.Server{
 			Addr:    addr,
-			Handler: r,
+			Handler: lockServing(r),
+		},
+		targetURL:   targetURL,
+		concurrency: 100,
+		maxSize:     defaultMaxSize,
+		scratchDir:  os.TempDir(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	// Keep enough idle connections to reuse them for concurrently called
+	// child nodes instead of opening new ones, which exhausts ephemeral
+	// ports on large fans. The number of connections is not limited as
+	// child nodes served by this server might call child nodes themselves.
+	s.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:          4 * s.concurrency,
+			MaxIdleConnsPerHost:   s.concurrency,
+			IdleConnTimeout:       90 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
 		},
-		targetURL: targetURL,
 	}
 
 	// --- ROUTES ---
 
+	task := "{task:" + strings.Join(taskNames, "|") + "}"
+
 	// Get help
 	r.HandleFunc("/help", handleHelp).Methods("GET")
 	// Health check for LM
 	r.HandleFunc("/healthz", s.handleHealthz).Methods("GET")
+	// Diagnostics
+	r.HandleFunc("/diag", s.handleDiag).Methods("GET")
+	// Memory leaked by leak tasks, DELETE /leaked frees kept memory
+	r.HandleFunc("/leaked", s.handleLeaked).Methods("GET", "DELETE")
+	// Request tree without executing it
+	r.HandleFunc("/plan/"+task, s.handlePlan).Methods("GET", "POST")
+	r.HandleFunc("/plan", s.handlePlan).Methods("GET", "POST")
 	// Internal requests
 	r.HandleFunc("/internal", s.handleInternalNode).Methods("POST")
-	// External requests
-	r.HandleFunc("/{task:sleep|fail|crash|cpu|ram}", s.handleRootNode).Methods("GET")
-	r.HandleFunc("/", s.handleRootNode).Methods("GET")
+	// External requests, POST requests define request graph in body
+	r.HandleFunc("/"+task, s.handleRootNode).Methods("GET", "POST")
+	r.HandleFunc("/", s.handleRootNode).Methods("GET", "POST")
 	return s
 }
 
@@ -72,8 +168,27 @@ func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "%s OK\n", s.id)
 }
 
+// Diagnostics endpoint
+func (s *Server) handleDiag(w http.ResponseWriter, r *http.Request) {
+	calibration.RLock()
+	d := struct {
+		Server          string    `json:"server"`
+		Version         string    `json:"version"`
+		CPULoopsPerUsec float64   `json:"cpuLoopsPerUsec"`
+		CPUCalibratedAt time.Time `json:"cpuCalibratedAt"`
+	}{s.id.String(), Version, calibration.loops, calibration.at}
+	calibration.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	e := json.NewEncoder(w)
+	if err := e.Encode(d); err != nil {
+		panic(err)
+	}
+}
+
 // ListenAndServe start server
 func (s *Server) ListenAndServe() error {
+	startCalibration(s.calibrationInterval)
 	if os.Getenv("DEBUG") != "" {
 		s.server.Handler = requestLogger(s.server.Handler)
 	}
@@ -2,100 +2,348 @@ package t2m
 
 import (
 	"log"
+	"math"
+	"runtime"
+	"sync"
 	"time"
 )
 
 // tasklet is a function to be executed in a go routine
 // tasklet execution can be stopped with struct{} send to the done channel
-// the only output channel a tasklet might use is the logger
-type tasklet func(l *log.Logger, done <-chan struct{})
+// the only output channels a tasklet might use are the logger
+// and the report, which is added to the node result once the tasklet returned
+type tasklet func(l *log.Logger, done <-chan struct{}, r taskReport)
+
+// taskReport holds values reported by a tasklet
+type taskReport map[string]interface{}
 
 // block until stopped
 func sleep() tasklet {
-	return func(l *log.Logger, done <-chan struct{}) {
+	return func(l *log.Logger, done <-chan struct{}, r taskReport) {
 		l.Println("Start none")
 		<-done
 		l.Println("End none")
 	}
 }
 
-// keep CPU busy for about us micro sec
-func cpuloop(us int) {
-	// dynamically calibrate on process start?
-	// statically calibrated on Intel(R) Xeon(R) CPU E5-2667 0 @ 2.90GHz
-	const lc = int(3.3 * 1000 * 1000)
-	count := (us * lc) / 1000
+// busy loop of count iterations
+func spin(count int) {
 	x, y := 0, 1
 	for i := 1; i < count; i++ {
 		x, y = y, x
 	}
 }
 
-// consume CPU until stopped
+// keep CPU busy for about us micro sec
+func cpuloop(us int) {
+	spin(int(float64(us) * loopsPerMicrosecond()))
+}
+
+// consume CPU of a single core until stopped
 // p: cpu amount to be consumed e.g. 0.2 == 20%
-func cpu(p float64) tasklet {
-	return func(l *log.Logger, done <-chan struct{}) {
-		l.Printf("Start CPU load %2.2f%%", p*100)
-		for end := false; !end; {
-			select {
-			case <-done:
-				end = true
-			default: // this should run about 10 ms
-				t := time.Now()
-				cpuloop(int(p * 10000.0))
-				time.Sleep(
-					time.Duration(
-						(1.0 - p) * float64(time.Since(t))))
-			}
+func cpuload(p float64, done <-chan struct{}) {
+	const period = 10 * time.Millisecond
+	for {
+		select {
+		case <-done:
+			return
+		default: // busy for p of period, idle for the rest
+			t := time.Now()
+			cpuloop(int(p * float64(period/time.Microsecond)))
+			time.Sleep(period - time.Since(t))
+		}
+	}
+}
+
+// consume CPU on several cores until stopped
+// p: cpu amount to be consumed per core e.g. 0.2 == 20%
+// cores: number of cores, limited by GOMAXPROCS
+func cpu(p float64, cores int) tasklet {
+	return func(l *log.Logger, done <-chan struct{}, r taskReport) {
+		if max := runtime.GOMAXPROCS(0); cores > max {
+			cores = max
+		}
+		l.Printf("Start CPU load %2.2f%% on %d core(s)", p*100, cores)
+		start := time.Now()
+		ct, ok := processCPUTime()
+		var wg sync.WaitGroup
+		wg.Add(cores)
+		for i := 0; i < cores; i++ {
+			go func() {
+				defer wg.Done()
+				cpuload(p, done)
+			}()
+		}
+		wg.Wait()
+		r["load"] = p
+		r["cores"] = cores
+		if ct2, ok2 := processCPUTime(); ok && ok2 {
+			// CPU time of the whole process, i.e. including other requests
+			r["utilization"] = float64(ct2-ct) / float64(time.Since(start))
 		}
 		l.Println("End CPU load")
 	}
 }
 
+// consume fraction q of the cgroup CPU quota until stopped
+// without quota, all CPUs are taken as quota
+func cpuQuota(q float64) tasklet {
+	return func(l *log.Logger, done <-chan struct{}, r taskReport) {
+		quota := float64(runtime.NumCPU())
+		if cl, err := readCgroupLimits(cgroupRoot); err == nil {
+			r["cgroup"] = cl
+			if cl.CPU > 0 {
+				quota = cl.CPU
+			}
+		}
+		r["quota"] = q
+		load := q * quota
+		cores := int(math.Ceil(load))
+		if max := runtime.GOMAXPROCS(0); cores > max {
+			cores = max
+		}
+		cpu(math.Min(1, load/float64(cores)), cores)(l, done, r)
+	}
+}
+
+// consume fraction f of the cgroup memory limit until stopped
+func ramFraction(f float64, a allocator) tasklet {
+	return func(l *log.Logger, done <-chan struct{}, r taskReport) {
+		cl, err := readCgroupLimits(cgroupRoot)
+		if err != nil || cl.Memory == 0 {
+			l.Println("No cgroup memory limit found")
+			r["error"] = "no cgroup memory limit found"
+			<-done
+			return
+		}
+		r["cgroup"] = cl
+		r["fraction"] = f
+		ram(uint64(f*float64(cl.Memory)), a)(l, done, r)
+	}
+}
+
 // fail after done
 func fail() tasklet {
-	return func(l *log.Logger, done <-chan struct{}) {
+	return func(l *log.Logger, done <-chan struct{}, r taskReport) {
 		l.Println("Start failing")
 		<-done
 		l.Panicln("End failing")
 	}
 }
 
-// crash after done
-func crash() tasklet {
-	return func(l *log.Logger, done <-chan struct{}) {
-		l.Println("Start crashing")
-		<-done
-		l.Fatalln("End crasing")
+// names of known tasks
+var taskNames = []string{"sleep", "fail", "crash", "cpu", "ram", "io", "leak", "gc", "status", "conn", "slow"}
+
+// names of task specific query parameters
+var taskArgNames = map[string][]string{
+	"fail":   {"p", "at"},
+	"crash":  {"mode", "code", "p", "at"},
+	"cpu":    {"load", "cores", "quota"},
+	"ram":    {"bytes", "fraction", "mode"},
+	"io":     {"bytes", "block", "rate", "read"},
+	"leak":   {"rate", "bytes", "keep"},
+	"gc":     {"rate", "object"},
+	"status": {"code", "retry", "body", "p", "at"},
+	"conn":   {"mode", "p", "at"},
+	"slow":   {"mode", "chunk", "p", "at"},
+}
+
+// check name is a known task, "" == no task
+func validTask(name string) bool {
+	if name == "" {
+		return true
+	}
+	for _, t := range taskNames {
+		if t == name {
+			return true
+		}
 	}
+	return false
 }
 
-func createTasklet(name string) tasklet {
+// create tasklet of task name with arguments a
+// scratchDir is used for files written by tasklets
+// return nil tasklet if task is not executed as tasklet
+// return errTaskArgument on invalid arguments
+func createTasklet(name string, a taskArgs, scratchDir string) (tasklet, error) {
 	var t tasklet
 	switch name {
 	case "sleep":
 		t = sleep()
 	case "fail":
+		if !validInjection(a) {
+			return nil, errTaskArgument
+		}
 		t = fail()
 	case "crash":
-		t = crash()
+		if !validInjection(a) {
+			return nil, errTaskArgument
+		}
+		code, err := a.int("code", 1)
+		if err != nil || code < 0 || code > 255 {
+			return nil, errTaskArgument
+		}
+		switch m := a["mode"]; m {
+		case "", "exit", "panic", "kill", "deadlock", "hang":
+			if m == "" {
+				m = "exit"
+			}
+			t = crash(m, code)
+		default:
+			return nil, errTaskArgument
+		}
+	case "status", "conn":
+		if !validInjection(a) {
+			return nil, errTaskArgument
+		}
+		if _, err := createResponder(name, a, 0); err != nil {
+			return nil, err
+		}
+		// response is written by responder
+		t = sleep()
+	case "slow":
+		if !validInjection(a) {
+			return nil, errTaskArgument
+		}
+		if _, _, err := slowArgs(a); err != nil {
+			return nil, err
+		}
+		// task is executed while reading request or writing response
 	case "cpu":
-		t = cpu(0.25) // 25% CPU
+		if _, ok := a["quota"]; ok {
+			q, err := a.float("quota", 0)
+			if err != nil || q <= 0 || a["load"] != "" || a["cores"] != "" {
+				return nil, errTaskArgument
+			}
+			t = cpuQuota(q)
+			break
+		}
+		p, err := a.float("load", 0.25) // 25% CPU
+		if err != nil || p <= 0 || p > 1 {
+			return nil, errTaskArgument
+		}
+		c := runtime.GOMAXPROCS(0)
+		if a["cores"] != "all" {
+			c, err = a.int("cores", 1)
+			if err != nil || c < 1 {
+				return nil, errTaskArgument
+			}
+		}
+		t = cpu(p, c)
 	case "ram":
-		t = ram(1024 * 1024 * 100) // 100 MB RAM
+		m, err := newAllocator(a["mode"])
+		if err != nil {
+			return nil, errTaskArgument
+		}
+		if _, ok := a["fraction"]; ok {
+			f, err := a.float("fraction", 0)
+			if err != nil || f <= 0 || a["bytes"] != "" {
+				return nil, errTaskArgument
+			}
+			t = ramFraction(f, m)
+			break
+		}
+		s, err := a.bytes("bytes", 1024*1024*100) // 100 MB RAM
+		if err != nil || s == 0 {
+			return nil, errTaskArgument
+		}
+		t = ram(s, m)
+	case "io":
+		s, err := a.bytes("bytes", 10*1024*1024)
+		if err != nil {
+			return nil, errTaskArgument
+		}
+		b, err := a.bytes("block", 64*1024)
+		if err != nil || b == 0 || b > s || b > 64*1024*1024 {
+			return nil, errTaskArgument
+		}
+		rate, err := a.bytes("rate", 10*1024*1024) // per sec
+		if err != nil || rate == 0 {
+			return nil, errTaskArgument
+		}
+		read, err := a.float("read", 0.5)
+		if err != nil || read < 0 || read > 1 {
+			return nil, errTaskArgument
+		}
+		t = diskio(scratchDir, s, b, rate, read)
+	case "leak":
+		rate, err := a.bytes("rate", 1024*1024) // per sec
+		if err != nil || rate == 0 {
+			return nil, errTaskArgument
+		}
+		max, err := a.bytes("bytes", 0)
+		if err != nil {
+			return nil, errTaskArgument
+		}
+		keep := false
+		switch a["keep"] {
+		case "", "false":
+		case "true":
+			keep = true
+		default:
+			return nil, errTaskArgument
+		}
+		t = leak(rate, max, keep)
+	case "gc":
+		rate, err := a.bytes("rate", 100*1024*1024) // per sec
+		if err != nil || rate == 0 {
+			return nil, errTaskArgument
+		}
+		size, err := a.bytes("object", 1024)
+		if err != nil || size == 0 || size > rate {
+			return nil, errTaskArgument
+		}
+		t = gc(rate, size)
 	}
-	return t
+	return t, nil
 }
 
-func (n *node) execTask() {
+// execute task of n for task duration
+// return report of tasklet once it returned
+func (n *node) execTask() taskReport {
 	if n.TaskName == "" {
-		return
+		return nil
+	}
+	t, err := createTasklet(n.TaskName, n.TaskArgs, n.scratchDir)
+	if err != nil { // already validated by root node
+		n.logger.Println(err)
+		return nil
+	}
+	if !n.injected() {
+		// failure is injected in other nodes only
+		t = sleep()
+	}
+	if t == nil {
+		if n.slowWrite() > 0 || n.readTime > 0 {
+			// task is executed while reading request or writing response
+			return nil
+		}
+		// e.g. no request body to read slowly
+		t = sleep()
 	}
-	t := createTasklet(n.TaskName)
 
+	r := taskReport{}
 	done := make(chan struct{})
-	go t(n.logger, done)
-	timer := time.NewTimer(time.Duration(n.TaskDuration) * time.Millisecond)
+	ended := make(chan struct{})
+	var failure interface{}
+	go func() {
+		defer func() {
+			failure = recover()
+			close(ended)
+		}()
+		t(n.logger, done, r)
+	}()
+	timer := time.NewTimer(n.taskDuration())
 	<-timer.C
 	close(done)
+	<-ended
+	if failure != nil {
+		// fail this request only, i.e. let the http server
+		// abort the connection instead of crashing the process
+		panic(failure)
+	}
+	if len(r) == 0 {
+		return nil
+	}
+	return r
 }
@@ -0,0 +1,88 @@
+package t2m
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+)
+
+// read and write a scratch file in dir until stopped
+// size: size of scratch file in bytes
+// block: bytes per read or write
+// rate: target throughput in bytes per sec
+// read: fraction of blocks read, the rest is written and synced
+// The file is written before it is read and removed when stopped.
+func diskio(dir string, size, block, rate uint64, read float64) tasklet {
+	return func(l *log.Logger, done <-chan struct{}, r taskReport) {
+		l.Printf("Start IO on %d bytes in %s", size, dir)
+		var written, reads, writes, syncs uint64
+		defer func() {
+			r["bytesRead"] = reads * block
+			r["bytesWritten"] = writes * block
+			r["syncs"] = syncs
+		}()
+		stop := func(err error) {
+			// e.g. disk quota exceeded, keep running until stopped
+			l.Println(err)
+			r["error"] = err.Error()
+			<-done
+		}
+
+		f, err := ioutil.TempFile(dir, "t2m-io-")
+		if err != nil {
+			stop(err)
+			return
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+
+		buf := make([]byte, block)
+		for i := range buf {
+			buf[i] = byte(i)
+		}
+		blocks := size / block
+		start := time.Now()
+		for {
+			select {
+			case <-done:
+				l.Println("End IO")
+				return
+			default:
+			}
+			ops := reads + writes
+			if written == blocks && float64(reads) < read*float64(ops+1) {
+				// read blocks in order of writing
+				off := int64((reads % blocks) * block)
+				if _, err := f.ReadAt(buf, off); err != nil {
+					stop(err)
+					return
+				}
+				reads++
+			} else {
+				off := int64((writes % blocks) * block)
+				if _, err := f.WriteAt(buf, off); err != nil {
+					stop(err)
+					return
+				}
+				if err := f.Sync(); err != nil {
+					stop(err)
+					return
+				}
+				writes++
+				syncs++
+				if written < blocks {
+					written++
+				}
+			}
+			// limit throughput to rate
+			due := time.Duration(float64((reads+writes)*block) / float64(rate) * float64(time.Second))
+			if d := due - time.Since(start); d > 0 {
+				select {
+				case <-done:
+				case <-time.After(d):
+				}
+			}
+		}
+	}
+}
@@ -1,10 +1,104 @@
 package t2m
 
-import "testing"
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// run tasklet t for duration d
+func runTasklet(t tasklet, d time.Duration) taskReport {
+	r := taskReport{}
+	done := make(chan struct{})
+	ended := make(chan struct{})
+	go func() {
+		t(log.New(ioutil.Discard, "", 0), done, r)
+		close(ended)
+	}()
+	time.Sleep(d)
+	close(done)
+	<-ended
+	return r
+}
 
 func BenchmarkCPULoop(b *testing.B) {
+	calibrateCPU()
+	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		// this should run for about one millisecond
 		cpuloop(1000)
 	}
 }
+
+func TestCPU(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	calibrateCPU()
+	r := runTasklet(cpu(0.5, 2), 300*time.Millisecond)
+	if r["load"] != 0.5 || r["cores"] != 2 {
+		t.Errorf("got load %v, cores %v, want 0.5, 2", r["load"], r["cores"])
+	}
+	if _, ok := processCPUTime(); ok {
+		// 2 cores half loaded, other tests might add to CPU time of process
+		if u, _ := r["utilization"].(float64); u < 0.5 || u > 2 {
+			t.Errorf("got utilization %v, want about 1", r["utilization"])
+		}
+	}
+
+	// limited by GOMAXPROCS
+	r = runTasklet(cpu(0.1, 100), 20*time.Millisecond)
+	if r["cores"] != 4 {
+		t.Errorf("got cores %v, want 4", r["cores"])
+	}
+}
+
+func TestDiskIO(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scratch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tl, err := createTasklet("io", taskArgs{
+		"bytes": "64Ki", "block": "4Ki", "rate": "1Mi", "read": "0.5",
+	}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := runTasklet(tl, 200*time.Millisecond)
+
+	if r["error"] != nil {
+		t.Fatal(r["error"])
+	}
+	// 16 blocks are written before reading starts
+	if w := r["bytesWritten"].(uint64); w < 64*1024 {
+		t.Errorf("written %d bytes, want at least %d", w, 64*1024)
+	}
+	if r["bytesRead"].(uint64) == 0 {
+		t.Error("no bytes read")
+	}
+	// rate limit: about 200Ki within 200ms
+	if total := r["bytesRead"].(uint64) + r["bytesWritten"].(uint64); total > 400*1024 {
+		t.Errorf("%d bytes exceed rate", total)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("scratch files not removed: %d", len(files))
+	}
+}
+
+func TestDiskIOArgs(t *testing.T) {
+	for _, a := range []taskArgs{
+		{"block": "0"},
+		{"bytes": "1Ki", "block": "4Ki"},
+		{"rate": "0"},
+		{"read": "1.5"},
+		{"read": "x"},
+	} {
+		if _, err := createTasklet("io", a, ""); err != errTaskArgument {
+			t.Errorf("%v: got %v, want %v", a, err, errTaskArgument)
+		}
+	}
+}
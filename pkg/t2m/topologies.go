@@ -0,0 +1,329 @@
+package t2m
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Tree describes a request tree as seen by a topology
+type Tree struct {
+	// Number of request nodes
+	Size int
+	// Seed for pseudo random decisions
+	Seed int64
+	// Topology specific parameters, passed on to all request nodes
+	Params url.Values
+}
+
+// Position locates a request node in a request tree
+type Position struct {
+	// Unique index of request node (starting at 1 == root node)
+	Index int
+	// Depth of request node (root node level == 0)
+	Depth int
+}
+
+// Topology defines the shape of a request tree.
+// Every request node computes its children on its own,
+// i.e. Children must only depend on its arguments.
+type Topology interface {
+	// Setup validates topology specific query parameters q of a root
+	// request, stores them in t.Params and adjusts t.Size if required.
+	Setup(t *Tree, q url.Values) error
+	// Children returns the positions of the child nodes of node p.
+	// Indices of child nodes must be greater than p.Index and at most
+	// t.Size, their depth must be p.Depth+1. This guarantees that
+	// request trees are finite. Invalid positions are dropped.
+	Children(t *Tree, p Position) []Position
+}
+
+var topologies = struct {
+	sync.RWMutex
+	m map[string]Topology
+}{m: make(map[string]Topology)}
+
+func init() {
+	RegisterTopology("fan", fan{})
+	RegisterTopology("chain", chain{})
+	RegisterTopology("tree", tree{})
+	RegisterTopology("layers", layers{})
+	RegisterTopology("random", random{})
+}
+
+// RegisterTopology makes a topology available by name
+// for the topology query parameter.
+// It panics if name is already registered or reserved.
+func RegisterTopology(name string, t Topology) {
+	topologies.Lock()
+	defer topologies.Unlock()
+	if t == nil {
+		panic("t2m: RegisterTopology topology is nil")
+	}
+	if _, dup := topologies.m[name]; dup || name == "" || name == "graph" {
+		panic("t2m: RegisterTopology called twice or reserved name " + name)
+	}
+	topologies.m[name] = t
+}
+
+func lookupTopology(name string) (Topology, bool) {
+	topologies.RLock()
+	defer topologies.RUnlock()
+	t, ok := topologies.m[name]
+	return t, ok
+}
+
+// sorted names of registered topologies
+func topologyNames() []string {
+	topologies.RLock()
+	defer topologies.RUnlock()
+	names := make([]string, 0, len(topologies.m))
+	for n := range topologies.m {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// upper bound of sizes computed by topologies
+// far beyond any sensible maximum size of a request tree
+const sizeLimit = 1 << 30
+
+// root node calls all other nodes
+type fan struct{}
+
+func (fan) Setup(t *Tree, q url.Values) error {
+	return nil
+}
+
+func (fan) Children(t *Tree, p Position) []Position {
+	if p.Index > 1 {
+		return nil
+	}
+	ps := make([]Position, t.Size-1)
+	for index := 2; index <= t.Size; index++ {
+		ps[index-2] = Position{Index: index, Depth: 1}
+	}
+	return ps
+}
+
+// every node calls the next node
+type chain struct{}
+
+func (chain) Setup(t *Tree, q url.Values) error {
+	return nil
+}
+
+func (chain) Children(t *Tree, p Position) []Position {
+	if p.Index >= t.Size {
+		return nil
+	}
+	return []Position{{Index: p.Index + 1, Depth: p.Depth + 1}}
+}
+
+// balanced tree with fanout children per node
+type tree struct{}
+
+func (tree) Setup(t *Tree, q url.Values) error {
+	f := q.Get("fanout")
+	if f == "" {
+		f = "2"
+	}
+	i, err := strconv.Atoi(f)
+	if err != nil || i < 1 {
+		return errQueryParameter
+	}
+	if i > t.Size-1 && t.Size > 1 {
+		// root node calls all other nodes at most
+		i = t.Size - 1
+	}
+	t.Params.Set("fanout", strconv.Itoa(i))
+	return nil
+}
+
+func (tree) Children(t *Tree, p Position) []Position {
+	k, _ := strconv.Atoi(t.Params.Get("fanout"))
+	// nodes are indexed in level order,
+	// i.e. children of node i are k*(i-1)+2 ... k*(i-1)+k+1
+	if k < 1 || p.Index-1 > (t.Size-2)/k {
+		// leaf node, check without overflow
+		return nil
+	}
+	first := k*(p.Index-1) + 2
+	count := k
+	if count > t.Size-first+1 {
+		count = t.Size - first + 1
+	}
+	ps := make([]Position, count)
+	for i := range ps {
+		ps[i] = Position{Index: first + i, Depth: p.Depth + 1}
+	}
+	return ps
+}
+
+// tree where all nodes at depth d have widths[d] children
+type layers struct{}
+
+// parse a comma separated list of widths e.g. 10,5,3
+func parseWidths(s string) ([]int, error) {
+	ws := []int{}
+	for _, f := range strings.Split(s, ",") {
+		w, err := strconv.Atoi(f)
+		if err != nil || w < 1 {
+			return nil, errQueryParameter
+		}
+		ws = append(ws, w)
+	}
+	return ws, nil
+}
+
+// number of nodes of a layers topology
+// stops counting as soon as sizeLimit is exceeded
+func layersSize(widths []int) int {
+	size, count := 1, 1
+	for _, w := range widths {
+		if count > sizeLimit/w {
+			return sizeLimit + 1
+		}
+		count *= w
+		size += count
+		if size > sizeLimit {
+			return sizeLimit + 1
+		}
+	}
+	return size
+}
+
+func (layers) Setup(t *Tree, q url.Values) error {
+	ws, err := parseWidths(q.Get("widths"))
+	if err != nil {
+		return err
+	}
+	// size is derived from widths
+	t.Size = layersSize(ws)
+	t.Params.Set("widths", q.Get("widths"))
+	return nil
+}
+
+func (layers) Children(t *Tree, p Position) []Position {
+	ws, err := parseWidths(t.Params.Get("widths"))
+	if err != nil || p.Depth >= len(ws) {
+		return nil
+	}
+	// nodes are indexed in level order
+	// index of first node and number of nodes at depth of p
+	first, count := 1, 1
+	for d := 0; d < p.Depth; d++ {
+		first += count
+		count *= ws[d]
+	}
+	w := ws[p.Depth]
+	ps := make([]Position, w)
+	for i := 0; i < w; i++ {
+		ps[i] = Position{
+			Index: first + count + (p.Index-first)*w + i,
+			Depth: p.Depth + 1,
+		}
+	}
+	return ps
+}
+
+// random recursive tree derived from seed
+type random struct{}
+
+// splitmix64 finalizer, used to derive
+// reproducible pseudo random numbers from a seed
+func mix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// parent index of node index in a random tree
+// every node but the root picks its parent uniformly
+// from all nodes with a lower index (random recursive tree)
+func randomParent(seed int64, index int) int {
+	if index <= 1 {
+		return 0
+	}
+	r := mix(uint64(seed) ^ mix(uint64(index)))
+	return 1 + int(r%uint64(index-1))
+}
+
+func (random) Setup(t *Tree, q url.Values) error {
+	return nil
+}
+
+func (random) Children(t *Tree, p Position) []Position {
+	// every node can compute its children
+	// from seed and size on its own
+	rt := lookupRandomTree(t.Seed, t.Size)
+	cs := rt.children[rt.first[p.Index]:rt.first[p.Index+1]]
+	ps := make([]Position, len(cs))
+	for i, index := range cs {
+		ps[i] = Position{Index: int(index), Depth: p.Depth + 1}
+	}
+	return ps
+}
+
+// children of all nodes of a random tree
+// children of node i are children[first[i]:first[i+1]]
+type randomTree struct {
+	first    []int32
+	children []int32
+}
+
+// compute random tree of size nodes in O(size)
+func newRandomTree(seed int64, size int) *randomTree {
+	rt := &randomTree{
+		first:    make([]int32, size+2),
+		children: make([]int32, size),
+	}
+	parents := make([]int32, size+1)
+	for index := 2; index <= size; index++ {
+		parents[index] = int32(randomParent(seed, index))
+		rt.first[parents[index]+1]++
+	}
+	for i := 1; i < len(rt.first); i++ {
+		rt.first[i] += rt.first[i-1]
+	}
+	// children in ascending order of index
+	next := append([]int32{}, rt.first...)
+	for index := 2; index <= size; index++ {
+		p := parents[index]
+		rt.children[next[p]] = int32(index)
+		next[p]++
+	}
+	return rt
+}
+
+// recently used random trees, all nodes of a request
+// served by a server share the random tree of the request
+var randomTrees = struct {
+	sync.Mutex
+	m     map[[2]int64]*randomTree
+	order [][2]int64
+}{m: make(map[[2]int64]*randomTree)}
+
+// number of random trees kept
+const randomTreesKept = 8
+
+func lookupRandomTree(seed int64, size int) *randomTree {
+	key := [2]int64{seed, int64(size)}
+	randomTrees.Lock()
+	defer randomTrees.Unlock()
+	if rt, ok := randomTrees.m[key]; ok {
+		return rt
+	}
+	rt := newRandomTree(seed, size)
+	if len(randomTrees.order) == randomTreesKept {
+		delete(randomTrees.m, randomTrees.order[0])
+		randomTrees.order = randomTrees.order[1:]
+	}
+	randomTrees.m[key] = rt
+	randomTrees.order = append(randomTrees.order, key)
+	return rt
+}
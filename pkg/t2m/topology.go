@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -12,12 +13,16 @@ import (
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 const (
-	maxSize = 1000
+	// default maximum number of request nodes
+	// larger request trees return summarized results by default
+	defaultMaxSize = 1000
 )
 
 var taskRe = regexp.MustCompile("/([^/?]*)")
@@ -30,6 +35,22 @@ type node struct {
 	RequestID uuid.UUID
 	// Topology of nodes
 	Topology string
+	// Topology specific parameters
+	Params url.Values `json:",omitempty"`
+	// Seed for pseudo random decisions e.g. of a random topology
+	Seed int64
+	// User defined request graph of a graph topology
+	Graph *graph `json:",omitempty"`
+	// Join mode of nodes with more than one parent in a graph topology
+	Join string
+	// Order of task execution relative to calling child nodes
+	Order string
+	// Mode of calling child nodes i.e. serial, parallel or batched:<size>
+	Spawn string
+	// Maximum number of child nodes called concurrently (0 == server default)
+	Concurrency int
+	// Summarize results instead of returning results per request node
+	Summarize bool
 	// Unique index of request node (starting at 1)
 	Index int
 	// Parents index of this request node (0 == no parent i.e. root node)
@@ -40,19 +61,36 @@ type node struct {
 	Depth int
 	// Name of Task
 	TaskName string
-	// Duration of task execution in ms
+	// Task specific arguments
+	TaskArgs taskArgs `json:",omitempty"`
+	// Duration of task execution in ms, 0 == sampled from TimeDistribution
 	TaskDuration int
+	// Distribution of task durations e.g. exp(40)
+	TimeDistribution string `json:",omitempty"`
 	// Logger used for this specific request node
 	logger *log.Logger
+	// Directory for files written by task
+	scratchDir string
+	// Summarize is given by request instead of derived from size
+	summarizeGiven bool
+	// Time of receiving the request
+	received time.Time
+	// Time spent on reading the request body slowly
+	readTime time.Duration
 }
 
 // construct a new node
 // set defaults and update values from URL
+// maxSize limits the size of the request tree
 // return errUnknownTask, ...
-func newNodeFromURL(url *url.URL) (*node, error) {
+func newNodeFromURL(u *url.URL, maxSize int) (*node, error) {
 	n := &node{
 		RequestID:    uuid.New(),
 		Topology:     "fan",
+		Params:       url.Values{},
+		Join:         "all",
+		Order:        "post",
+		Spawn:        "parallel",
 		Index:        1,
 		ParentIndex:  0,
 		Size:         1,
@@ -64,15 +102,14 @@ func newNodeFromURL(url *url.URL) (*node, error) {
 	// parse URL and update node values accordingly
 
 	// get task name
-	switch t := taskRe.FindStringSubmatch(url.RequestURI())[1]; t {
-	case "", "sleep", "fail", "crash", "cpu", "ram":
-		n.TaskName = t
-	default:
+	t := taskRe.FindStringSubmatch(u.RequestURI())[1]
+	if !validTask(t) {
 		return nil, errUnknownTask
 	}
+	n.TaskName = t
 
 	// get query parameter
-	q := url.Query()
+	q := u.Query()
 
 	// n.Size
 	if s, ok := q["size"]; ok {
@@ -83,23 +120,110 @@ func newNodeFromURL(url *url.URL) (*node, error) {
 		n.Size = i
 	}
 
-	// n.Topology
+	// n.Seed
+	if sd, ok := q["seed"]; ok {
+		i, err := strconv.ParseInt(sd[0], 10, 64)
+		if err != nil {
+			return nil, errQueryParameter
+		}
+		n.Seed = i
+	} else {
+		n.Seed = time.Now().UnixNano()
+	}
+
+	// n.Topology, n.Params
 	if t, ok := q["topology"]; ok {
-		switch t[0] {
-		case "fan", "chain", "tree":
-			n.Topology = t[0]
+		n.Topology = t[0]
+	}
+	tp, ok := lookupTopology(n.Topology)
+	if !ok {
+		return nil, errQueryParameter
+	}
+	tt := n.tree()
+	if err := tp.Setup(tt, q); err != nil || tt.Size < 1 || tt.Size > maxSize {
+		return nil, errQueryParameter
+	}
+	n.Size, n.Params = tt.Size, tt.Params
+
+	// n.Join
+	if j, ok := q["join"]; ok {
+		switch j[0] {
+		case "all", "once":
+			n.Join = j[0]
 		default:
 			return nil, errQueryParameter
 		}
 	}
 
-	// n.TaskDuration
-	if t, ok := q["time"]; ok {
-		t, err := strconv.Atoi(t[0])
-		if err != nil || t < 1 {
+	// n.Order
+	if o, ok := q["order"]; ok {
+		switch o[0] {
+		case "pre", "post", "parallel":
+			n.Order = o[0]
+		default:
+			return nil, errQueryParameter
+		}
+	}
+
+	// n.Spawn
+	if sp, ok := q["spawn"]; ok {
+		n.Spawn = sp[0]
+		if n.batchSize() < 0 {
 			return nil, errQueryParameter
 		}
-		n.TaskDuration = t
+	}
+
+	// n.Concurrency
+	if c, ok := q["concurrency"]; ok {
+		i, err := strconv.Atoi(c[0])
+		if err != nil || i < 1 {
+			return nil, errQueryParameter
+		}
+		n.Concurrency = i
+	}
+
+	// n.Summarize
+	n.Summarize = n.Size > defaultMaxSize
+	if r, ok := q["result"]; ok {
+		switch r[0] {
+		case "full":
+			n.Summarize = false
+		case "summary":
+			n.Summarize = true
+		default:
+			return nil, errQueryParameter
+		}
+		n.summarizeGiven = true
+	}
+
+	// n.TaskDuration, n.TimeDistribution
+	if t, ok := q["time"]; ok {
+		if i, err := strconv.Atoi(t[0]); err == nil {
+			if i < 1 {
+				return nil, errQueryParameter
+			}
+			n.TaskDuration = i
+		} else {
+			d, err := parseDistribution(t[0])
+			if err != nil {
+				return nil, err
+			}
+			n.TaskDuration = 0
+			n.TimeDistribution = d.String()
+		}
+	}
+
+	// n.TaskArgs
+	for _, k := range taskArgNames[n.TaskName] {
+		if v, ok := q[k]; ok {
+			if n.TaskArgs == nil {
+				n.TaskArgs = taskArgs{}
+			}
+			n.TaskArgs[k] = v[0]
+		}
+	}
+	if _, err := createTasklet(n.TaskName, n.TaskArgs, ""); err != nil {
+		return nil, err
 	}
 
 	return n, nil
@@ -110,69 +234,151 @@ func newNodeFromURL(url *url.URL) (*node, error) {
 // return errUnknownTask, ...
 func (n *node) newChild() *node {
 	c := &node{
-		RequestID:    uuid.New(),
-		Topology:     n.Topology,
-		Index:        -1, // unspecified
-		ParentIndex:  n.Index,
-		Size:         n.Size,
-		Depth:        -1, // unspecified
-		TaskName:     n.TaskName,
-		TaskDuration: n.TaskDuration,
+		RequestID:        uuid.New(),
+		Topology:         n.Topology,
+		Params:           n.Params,
+		Seed:             n.Seed,
+		Graph:            n.Graph,
+		Join:             n.Join,
+		Order:            n.Order,
+		Spawn:            n.Spawn,
+		Concurrency:      n.Concurrency,
+		Summarize:        n.Summarize,
+		Index:            -1, // unspecified
+		ParentIndex:      n.Index,
+		Size:             n.Size,
+		Depth:            -1, // unspecified
+		TaskName:         n.TaskName,
+		TaskArgs:         n.TaskArgs,
+		TaskDuration:     n.TaskDuration,
+		TimeDistribution: n.TimeDistribution,
 	}
 
 	return c
 }
 
+// replace topology of root node n by graph decoded from r
+func (n *node) setGraph(r io.Reader, maxSize int) error {
+	g, err := decodeGraph(r, n.TaskName, n.TaskArgs, n.TaskDuration, maxSize)
+	if err != nil {
+		return err
+	}
+	n.Topology = "graph"
+	n.Graph = g
+	n.Size = len(g.Nodes)
+	if !n.summarizeGiven {
+		n.Summarize = n.Size > defaultMaxSize
+	}
+	n.TaskName = g.node(1).Task
+	n.TaskArgs = g.node(1).Args
+	n.TaskDuration = g.node(1).Time
+	return nil
+}
+
+// duration of task execution of n
+// either fixed or sampled from time distribution using seed and index
+func (n *node) taskDuration() time.Duration {
+	if n.TaskDuration > 0 {
+		return time.Duration(n.TaskDuration) * time.Millisecond
+	}
+	d, err := parseDistribution(n.TimeDistribution)
+	if err != nil { // already validated by root node
+		return 0
+	}
+	return d.sample(n.Seed, n.Index)
+}
+
+// seed is returned with results to allow to repeat pseudo random decisions
+func (n *node) hasSeed() bool {
+	return n.Topology == "random" || n.TimeDistribution != "" ||
+		n.TaskArgs["p"] != ""
+}
+
+// number of child nodes called at once according to spawn mode
+// 0 == all at once, < 0 == invalid spawn mode
+func (n *node) batchSize() int {
+	switch n.Spawn {
+	case "parallel":
+		return 0
+	case "serial":
+		return 1
+	}
+	if !strings.HasPrefix(n.Spawn, "batched:") {
+		return -1
+	}
+	k, err := strconv.Atoi(strings.TrimPrefix(n.Spawn, "batched:"))
+	if err != nil || k < 1 {
+		return -1
+	}
+	return k
+}
+
+// request tree as seen by topology of n
+func (n *node) tree() *Tree {
+	return &Tree{Size: n.Size, Seed: n.Seed, Params: n.Params}
+}
+
+// log to logger of n if any
+func (n *node) logf(format string, v ...interface{}) {
+	if n.logger != nil {
+		n.logger.Printf(format, v...)
+	} else {
+		log.Printf(format, v...)
+	}
+}
+
 // Create child node structures
 // to be passed to subsequent requests
 func (n *node) children() []*node {
 	cn := []*node{}
-	switch n.Topology {
-
-	case "tree":
-		cn = make([]*node, 0, 2)
-		for i := 0; i < 2; i++ {
-			index := n.Index + 1<<(uint(n.Depth+i))
-			if index > n.Size {
-				break
+	if n.Topology == "graph" {
+		// task and duration are defined per node
+		for _, index := range n.Graph.node(n.Index).Children {
+			if n.Join == "once" && n.Graph.firstParent(index) != n.Index {
+				// deduplicated, i.e. called by another parent
+				continue
 			}
+			gn := n.Graph.node(index)
 			nn := n.newChild()
 			nn.Depth = n.Depth + 1
 			nn.Index = index
+			nn.TaskName = gn.Task
+			nn.TaskArgs = gn.Args
+			nn.TaskDuration = gn.Time
 			cn = append(cn, nn)
 		}
+		return cn
+	}
 
-	case "chain":
-		if n.Index == n.Size {
-			break
+	t, ok := lookupTopology(n.Topology)
+	if !ok {
+		return cn
+	}
+	self := Position{Index: n.Index, Depth: n.Depth}
+	for _, p := range t.Children(n.tree(), self) {
+		if p.Index <= n.Index || p.Index > n.Size || p.Depth != n.Depth+1 {
+			// e.g. a cycle of a registered topology
+			n.logf("topology %s: invalid child %+v of %+v", n.Topology, p, self)
+			continue
 		}
 		nn := n.newChild()
-		nn.Index = n.Index + 1
-		nn.Depth = n.Depth + 1
-		cn = []*node{nn}
-
-	case "fan":
-		if n.Index > 1 {
-			break
-		}
-		cn = make([]*node, n.Size-1)
-		for index := 2; index <= n.Size; index++ {
-			nn := n.newChild()
-			nn.Depth = 1
-			nn.Index = index
-			cn[index-2] = nn
-		}
+		nn.Depth = p.Depth
+		nn.Index = p.Index
+		cn = append(cn, nn)
 	}
-
 	return cn
 }
 
-func (n *node) spawn(c *node, url string) (*http.Response, error) {
+func (n *node) spawn(client *http.Client, c *node, url string) (*http.Response, error) {
 	// create request body
 	body, err := json.Marshal(c)
 	if err != nil {
 		return nil, err
 	}
+	if d, chunk := c.slowRead(); d > 0 {
+		// child node can not know before reading its request
+		url += fmt.Sprintf("?read=%s&chunk=%d", d, chunk)
+	}
 	// create request object
 	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
 	if err != nil {
@@ -182,7 +388,7 @@ func (n *node) spawn(c *node, url string) (*http.Response, error) {
 	req.Header.Set("Content-Type", "application/json")
 
 	// do request
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -190,99 +396,250 @@ func (n *node) spawn(c *node, url string) (*http.Response, error) {
 }
 
 func (s *Server) handleRootNode(w http.ResponseWriter, r *http.Request) {
-	n, err := newNodeFromURL(r.URL)
+	received := time.Now()
+	n, err := newNodeFromURL(r.URL, s.maxSize)
 	if err != nil {
-		// TODO better error handling
-		log.Fatalln("Oops", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n.received = received
+	if r.Method == "POST" {
+		r.Body = http.MaxBytesReader(w, r.Body, maxGraphBytes(s.maxSize))
+		d, chunk := n.slowRead()
+		if d > 0 {
+			r.Body = newSlowReader(r.Body, r.ContentLength, chunk, d)
+		}
+		// request graph is given by request body
+		t := time.Now()
+		if err := n.setGraph(r.Body, s.maxSize); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if d > 0 {
+			n.readTime = time.Since(t)
+		}
 	}
 	prefix := fmt.Sprintf("[S: %s, R: %s, D: %04d, P: %04d, N: %04d]\n  ",
 		s.id, n.RequestID, 0, 0, 1)
 	n.logger = log.New(os.Stdout, prefix, log.Lmicroseconds)
+	n.scratchDir = s.scratchDir
 	s.handleNode(n, w, r)
 }
 
 func (s *Server) handleInternalNode(w http.ResponseWriter, r *http.Request) {
 	// decode node
-	n := &node{}
+	n := &node{received: time.Now()}
+	slow := false
+	if rd := r.URL.Query().Get("read"); rd != "" {
+		// slow reading requested by parent
+		d, err := time.ParseDuration(rd)
+		chunk, err2 := strconv.Atoi(r.URL.Query().Get("chunk"))
+		if err == nil && err2 == nil && chunk > 0 {
+			r.Body = newSlowReader(r.Body, r.ContentLength, chunk, d)
+			slow = true
+		}
+	}
 	b, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		panic(err)
 	}
+	if slow {
+		n.readTime = time.Since(n.received)
+	}
 	if err := json.Unmarshal(b, n); err != nil {
 		panic(err)
 	}
 	prefix := fmt.Sprintf("[S: %s, R: %s, D: %04d, P: %04d, N: %04d]\n  ",
 		s.id, n.RequestID, n.Depth, n.ParentIndex, n.Index)
 	n.logger = log.New(os.Stdout, prefix, log.Lmicroseconds)
+	n.scratchDir = s.scratchDir
 	s.handleNode(n, w, r)
 }
 
 func (s *Server) handleNode(n *node, w http.ResponseWriter, r *http.Request) {
 	// here we start
 	n.logger.Printf("request started")
+	start := n.received
+	if start.IsZero() {
+		start = time.Now()
+	}
 
 	cn := n.children()
 
+	// timings of this node
+	self := nodeResult{
+		Index:  n.Index,
+		Parent: n.ParentIndex,
+		Depth:  n.Depth,
+	}
+	if n.TaskName != "" {
+		self.Time = ms(n.taskDuration())
+	}
+
+	// Execute task on any node
+	// before, while or after child nodes are called
+	var taskTime time.Duration
+	// panic of a failing task, raised again by the handler
+	var failure interface{}
+	task := make(chan struct{})
+	runTask := func() {
+		defer func() {
+			failure = recover()
+			close(task)
+		}()
+		t := time.Now()
+		self.Report = n.execTask()
+		taskTime = time.Since(t)
+	}
+	switch n.Order {
+	case "pre":
+		runTask()
+		if failure != nil {
+			// do not call child nodes of a failed node
+			panic(failure)
+		}
+	case "parallel":
+		go runTask()
+	}
+	t := time.Now()
+	statusCode, cr := s.callChildren(n, cn)
+	self.Children = ms(time.Since(t))
+	if n.Order == "post" {
+		runTask()
+	}
+	<-task
+	if failure != nil {
+		panic(failure)
+	}
+	self.Task = ms(taskTime + n.readTime)
+	self.Elapsed = ms(time.Since(start))
+	if d := n.slowWrite(); d > 0 {
+		// response is written slowly after timings are encoded
+		self.Task += ms(d)
+		self.Elapsed += ms(d)
+	}
+
 	// node result(s)
-	nr := make(map[string]string)
-	nr[s.id.String()] = fmt.Sprintf("%04d", n.Index)
+	nr := newResult(s.id.String(), self, n.Summarize)
+	if n.ParentIndex == 0 && n.hasSeed() {
+		// allow to repeat a random topology or time distribution
+		nr.Seed = &n.Seed
+	}
+	for _, c := range cr {
+		nr.merge(c)
+	}
+
+	// write aggregated noderesult to response body encoded in json
+	// unless the task of this node writes the response
+	rsp, err := createResponder(n.TaskName, n.TaskArgs, n.taskDuration())
+	if err != nil { // already validated by root node
+		n.logger.Println(err)
+	}
+	if rsp != nil && n.injected() {
+		body, err := json.Marshal(nr)
+		if err != nil {
+			panic(err)
+		}
+		rsp(w, statusCode, append(body, '\n'))
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		e := json.NewEncoder(w)
+		if err := e.Encode(nr); err != nil {
+			panic(err)
+		}
+	}
+
+	// we are done with this node
+	n.logger.Printf("request ended")
+}
 
+// call child nodes cn of n
+// at most batch size child nodes are called at once
+// return http status code to be used for response of n
+// and results of child nodes
+func (s *Server) callChildren(n *node, cn []*node) (int, []*result) {
+	statusCode := http.StatusOK
+	results := make([]*result, 0, len(cn))
+	size := n.batchSize()
+	for len(cn) > 0 {
+		b := len(cn)
+		if size > 0 && size < b {
+			b = size
+		}
+		sc, rs := s.callBatch(n, cn[:b])
+		if sc != http.StatusOK {
+			statusCode = sc
+		}
+		results = append(results, rs...)
+		cn = cn[b:]
+	}
+	return statusCode, results
+}
+
+// call child nodes cn of n concurrently
+// using a pool of at most concurrency workers
+func (s *Server) callBatch(n *node, cn []*node) (int, []*result) {
 	type childResult struct {
-		resp *http.Response
-		err  error
+		index int
+		resp  *http.Response
+		err   error
 	}
 
 	statusCode := http.StatusOK
+	results := make([]*result, 0, len(cn))
+
+	workers := n.Concurrency
+	if workers == 0 {
+		workers = s.concurrency
+	}
+	if workers > len(cn) {
+		workers = len(cn)
+	}
+	todo := make(chan *node, len(cn))
+	for _, c := range cn {
+		todo <- c
+	}
+	close(todo)
 
 	rc := make(chan childResult, len(cn))
 	// spawn child nodes
-	for _, c := range cn {
-		go func(c *node) {
-			resp, err := n.spawn(c, s.targetURL+"/internal")
-			rc <- childResult{resp, err}
-		}(c)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for c := range todo {
+				resp, err := n.spawn(s.client, c, s.targetURL+"/internal")
+				rc <- childResult{c.Index, resp, err}
+			}
+		}()
 	}
 	// fetch results from child nodes
 	for range cn {
 		cr := <-rc
-		if cr.err != nil { // failure upon request to spawn a child
-			panic(cr.err)
+		if cr.err != nil {
+			// child failed without response e.g. connection aborted
+			n.logger.Printf("child %d failed: %s", cr.index, cr.err)
+			statusCode = http.StatusServiceUnavailable // 503
+			results = append(results, newFailedResult(cr.index, n.Summarize))
+			continue
 		}
 		if cr.resp.StatusCode != http.StatusOK {
 			// tread non 200 http response as intermediate problem
 			statusCode = http.StatusServiceUnavailable // 503
 		}
 		body, err := ioutil.ReadAll(cr.resp.Body)
-		if err != nil {
-			panic(err)
-		}
-		cnr := make(map[string]string)
-		if err := json.Unmarshal(body, &cnr); err != nil {
-			panic(err)
+		cr.resp.Body.Close()
+		cnr := &result{}
+		if err == nil {
+			err = json.Unmarshal(body, cnr)
 		}
-
-		// merge client result with node result
-		for k, v := range cnr {
-			if nr[k] == "" {
-				nr[k] = v
-			} else {
-				// merge values
-				nr[k] = fmt.Sprintf("%s %s", nr[k], v)
-			}
+		if err != nil {
+			// e.g. truncated body or error page of an injected status
+			n.logger.Printf("child %d failed: %s", cr.index, err)
+			statusCode = http.StatusServiceUnavailable // 503
+			results = append(results, newFailedResult(cr.index, n.Summarize))
+			continue
 		}
+		results = append(results, cnr)
 	}
-
-	// Execute task on any node
-	n.execTask()
-
-	w.WriteHeader(statusCode)
-	w.Header().Set("Content-Type", "application/json")
-	// write aggregated noderesult to response body encoded in json
-	e := json.NewEncoder(w)
-	if err := e.Encode(nr); err != nil {
-		panic(err)
-	}
-
-	// we are done with this node
-	n.logger.Printf("request ended")
+	return statusCode, results
 }
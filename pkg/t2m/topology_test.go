@@ -0,0 +1,590 @@
+package t2m
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// walk the tree starting at the root node
+// and return nodes in order of appearance
+func walk(root *node) []*node {
+	nodes := []*node{root}
+	for i := 0; i < len(nodes); i++ {
+		nodes = append(nodes, nodes[i].children()...)
+	}
+	return nodes
+}
+
+func TestTreeChildren(t *testing.T) {
+	tests := []struct {
+		fanout int
+		size   int
+		depth  int
+	}{
+		{1, 5, 4},
+		{2, 1, 0},
+		{2, 7, 2},
+		{2, 8, 3},
+		{3, 13, 2},
+		{3, 14, 3},
+		{5, 100, 3},
+		{10, 1000, 3},
+		{2000000000, 2, 1},
+	}
+	for _, tt := range tests {
+		root := &node{Topology: "tree", Index: 1, Size: tt.size,
+			Params: url.Values{"fanout": {strconv.Itoa(tt.fanout)}}}
+		nodes := walk(root)
+		if len(nodes) != tt.size {
+			t.Errorf("fanout %d, size %d: got %d nodes",
+				tt.fanout, tt.size, len(nodes))
+			continue
+		}
+		seen := make(map[int]bool)
+		depth := 0
+		for _, n := range nodes {
+			if n.Index < 1 || n.Index > tt.size || seen[n.Index] {
+				t.Errorf("fanout %d, size %d: unexpected index %d",
+					tt.fanout, tt.size, n.Index)
+			}
+			seen[n.Index] = true
+			if len(n.children()) > tt.fanout {
+				t.Errorf("fanout %d, size %d: node %d has %d children",
+					tt.fanout, tt.size, n.Index, len(n.children()))
+			}
+			if n.Depth > depth {
+				depth = n.Depth
+			}
+		}
+		if depth != tt.depth {
+			t.Errorf("fanout %d, size %d: got depth %d, want %d",
+				tt.fanout, tt.size, depth, tt.depth)
+		}
+	}
+}
+
+func TestLayersChildren(t *testing.T) {
+	widths := []int{10, 5, 3}
+	root := &node{Topology: "layers", Index: 1, Size: layersSize(widths),
+		Params: url.Values{"widths": {"10,5,3"}}}
+	if root.Size != 211 {
+		t.Fatalf("got size %d, want 211", root.Size)
+	}
+	nodes := walk(root)
+	if len(nodes) != root.Size {
+		t.Fatalf("got %d nodes, want %d", len(nodes), root.Size)
+	}
+	for i, n := range nodes {
+		// walk visits nodes in level order
+		if n.Index != i+1 {
+			t.Errorf("got index %d, want %d", n.Index, i+1)
+		}
+		want := 0
+		if n.Depth < len(widths) {
+			want = widths[n.Depth]
+		}
+		if got := len(n.children()); got != want {
+			t.Errorf("node %d at depth %d: got %d children, want %d",
+				n.Index, n.Depth, got, want)
+		}
+	}
+}
+
+func TestRandomChildren(t *testing.T) {
+	for _, seed := range []int64{0, 1, 42, -7} {
+		root := &node{Topology: "random", Seed: seed, Index: 1, Size: 500}
+		nodes := walk(root)
+		if len(nodes) != root.Size {
+			t.Errorf("seed %d: got %d nodes, want %d",
+				seed, len(nodes), root.Size)
+			continue
+		}
+		seen := make(map[int]bool)
+		for _, n := range nodes {
+			if seen[n.Index] {
+				t.Errorf("seed %d: index %d seen twice", seed, n.Index)
+			}
+			seen[n.Index] = true
+			// a node only knowing seed and index computes the same children
+			nn := &node{Topology: "random", Seed: seed, Index: n.Index,
+				Size: n.Size}
+			if len(nn.children()) != len(n.children()) {
+				t.Errorf("seed %d: children of %d differ", seed, n.Index)
+			}
+			// children are those nodes picking n as parent
+			want := []int{}
+			for i := n.Index + 1; i <= n.Size; i++ {
+				if randomParent(seed, i) == n.Index {
+					want = append(want, i)
+				}
+			}
+			cs := n.children()
+			for i := range want {
+				if i >= len(cs) || cs[i].Index != want[i] ||
+					cs[i].Depth != n.Depth+1 {
+					t.Errorf("seed %d: children of %d differ from parents",
+						seed, n.Index)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestNewNodeFromURL(t *testing.T) {
+	tests := []struct {
+		url string
+		err error
+	}{
+		{"/", nil},
+		{"/sleep?size=10&topology=tree&fanout=3", nil},
+		{"/unknown", errUnknownTask},
+		{"/?size=0", errQueryParameter},
+		{"/?topology=unknown", errQueryParameter},
+		{"/?topology=tree&fanout=0", errQueryParameter},
+		{"/?topology=tree&fanout=2000000000&size=2", nil},
+		{"/?topology=layers&widths=10,5,3", nil},
+		{"/?topology=layers", errQueryParameter},
+		{"/?topology=layers&widths=10,0", errQueryParameter},
+		{"/?topology=layers&widths=100,100", errQueryParameter},
+		{"/?topology=graph", errQueryParameter},
+		{"/?topology=random&size=100&seed=42", nil},
+		{"/?topology=random&seed=x", errQueryParameter},
+		{"/?join=once", nil},
+		{"/?join=twice", errQueryParameter},
+		{"/?order=parallel", nil},
+		{"/?order=random", errQueryParameter},
+		{"/?spawn=serial", nil},
+		{"/?spawn=batched:3", nil},
+		{"/?spawn=batched:0", errQueryParameter},
+		{"/?spawn=batched", errQueryParameter},
+		{"/?concurrency=10", nil},
+		{"/?concurrency=0", errQueryParameter},
+		{"/?result=summary", nil},
+		{"/?result=none", errQueryParameter},
+		{"/?size=1001", errQueryParameter},
+		{"/cpu?load=0.8", nil},
+		{"/cpu?load=1.5", errTaskArgument},
+		{"/cpu?cores=all", nil},
+		{"/cpu?cores=2&load=0.5", nil},
+		{"/cpu?cores=0", errTaskArgument},
+		{"/cpu?cores=x", errTaskArgument},
+		{"/ram?bytes=512Mi", nil},
+		{"/ram?bytes=lots", errTaskArgument},
+		{"/sleep?bytes=lots", nil},
+		{"/gc?object=1Ki", nil},
+		{"/gc?object=0", errTaskArgument},
+		{"/cpu?load=NaN", errTaskArgument},
+		{"/cpu?quota=NaN", errTaskArgument},
+		{"/cpu?quota=1.5", nil},
+		{"/cpu?quota=1.5&load=0.5", errTaskArgument},
+		{"/cpu?quota=1.5&cores=2", errTaskArgument},
+		{"/cpu?quota=0", errTaskArgument},
+		{"/ram?bytes=NaN", errTaskArgument},
+		{"/ram?fraction=NaN", errTaskArgument},
+		{"/io?read=NaN", errTaskArgument},
+		{"/fail?p=NaN", errTaskArgument},
+		{"/?time=x", errQueryParameter},
+		{"/?time=0", errQueryParameter},
+		{"/?time=exp(40)", nil},
+		{"/?time=exp(-40)", errQueryParameter},
+		{"/?time=normal(50)", errQueryParameter},
+		{"/fail?p=0.05&at=depth:2", nil},
+		{"/crash?p=1.5", errTaskArgument},
+		{"/fail?at=nowhere", errTaskArgument},
+		{"/crash?mode=kill", nil},
+		{"/crash?mode=exit&code=3", nil},
+		{"/crash?mode=exit&code=256", errTaskArgument},
+		{"/crash?mode=reboot", errTaskArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := newNodeFromURL(u, defaultMaxSize); err != tt.err {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+// ring is registered by tests only
+type ring struct{}
+
+func (ring) Setup(t *Tree, q url.Values) error {
+	t.Params.Set("hops", q.Get("hops"))
+	return nil
+}
+
+func (ring) Children(t *Tree, p Position) []Position {
+	if p.Index == t.Size {
+		return nil
+	}
+	return []Position{{Index: p.Index + 1, Depth: p.Depth + 1}}
+}
+
+func TestRegisterTopology(t *testing.T) {
+	const name = "test-ring"
+	RegisterTopology(name, ring{})
+	t.Cleanup(func() {
+		topologies.Lock()
+		delete(topologies.m, name)
+		topologies.Unlock()
+	})
+	u, _ := url.Parse("/?topology=" + name + "&size=3&hops=2")
+	n, err := newNodeFromURL(u, defaultMaxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Params.Get("hops") != "2" {
+		t.Errorf("got params %v, want hops=2", n.Params)
+	}
+	if got := len(walk(n)); got != 3 {
+		t.Errorf("got %d nodes, want 3", got)
+	}
+	found := false
+	for _, tn := range topologyNames() {
+		found = found || tn == name
+	}
+	if !found {
+		t.Errorf("%s not in %v", name, topologyNames())
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering %s twice should panic", name)
+		}
+	}()
+	RegisterTopology(name, ring{})
+}
+
+func TestTreeFanoutLimit(t *testing.T) {
+	u, _ := url.Parse("/?topology=tree&fanout=2000000000&size=5")
+	n, err := newNodeFromURL(u, defaultMaxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := n.Params.Get("fanout"); f != "4" {
+		t.Errorf("got fanout %s, want 4", f)
+	}
+}
+
+// start server calling itself for child nodes
+// hook is called before serving a request, the returned function after
+func newTestServer(t *testing.T, hook func(r *http.Request) func(),
+	opts ...ServerOption) (*httptest.Server, *Server) {
+	ts := httptest.NewUnstartedServer(nil)
+	s := NewServer("", "http://"+ts.Listener.Addr().String(), opts...)
+	h := s.server.Handler
+	ts.Config.Handler = http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if hook != nil {
+				defer hook(r)()
+			}
+			h.ServeHTTP(w, r)
+		})
+	// failing nodes are expected
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return ts, s
+}
+
+// get result of request u
+func getResult(t *testing.T, u string) (int, *result) {
+	resp, err := http.Get(u)
+	if err != nil {
+		return 0, nil
+	}
+	defer resp.Body.Close()
+	r := &result{}
+	if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, r
+}
+
+// root node result
+func rootResult(t *testing.T, r *result) nodeResult {
+	for _, nr := range r.Nodes {
+		if nr.Index == 1 {
+			return nr
+		}
+	}
+	t.Fatal("no root node result")
+	return nodeResult{}
+}
+
+func TestHandleNodeOrder(t *testing.T) {
+	// time of first call of a child node since start of root request
+	var mu sync.Mutex
+	var start time.Time
+	var firstChild time.Duration
+	ts, _ := newTestServer(t, func(r *http.Request) func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/internal" && firstChild == 0 {
+			firstChild = time.Since(start)
+		}
+		return func() {}
+	})
+
+	tests := []struct {
+		order string
+		// child called after task of root
+		after bool
+		// task of root executed while children are called
+		parallel bool
+	}{
+		{"pre", true, false},
+		{"post", false, false},
+		{"parallel", false, true},
+	}
+	for _, tt := range tests {
+		mu.Lock()
+		start, firstChild = time.Now(), 0
+		mu.Unlock()
+		code, r := getResult(t, ts.URL+"/sleep?size=2&time=100&order="+tt.order)
+		if code != http.StatusOK {
+			t.Fatalf("%s: got status %d", tt.order, code)
+		}
+		root := rootResult(t, r)
+		mu.Lock()
+		fc := ms(firstChild)
+		mu.Unlock()
+		if after := fc >= root.Task; after != tt.after {
+			t.Errorf("%s: child called after %.1fms, task %.1fms",
+				tt.order, fc, root.Task)
+		}
+		sum := root.Task + root.Children
+		if parallel := root.Elapsed < sum*0.75; parallel != tt.parallel {
+			t.Errorf("%s: elapsed %.1fms, task %.1fms, children %.1fms",
+				tt.order, root.Elapsed, root.Task, root.Children)
+		}
+	}
+}
+
+func TestHandleNodeFailingPreTask(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	ts, _ := newTestServer(t, func(r *http.Request) func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/internal" {
+			calls++
+		}
+		return func() {}
+	})
+	for _, tt := range []struct {
+		order string
+		calls int
+	}{
+		{"pre", 0},
+		{"post", 2},
+	} {
+		mu.Lock()
+		calls = 0
+		mu.Unlock()
+		if code, _ := getResult(t, ts.URL+"/fail?size=3&time=10&at=root&order="+tt.order); code != 0 {
+			t.Errorf("%s: got status %d, want aborted connection", tt.order, code)
+		}
+		mu.Lock()
+		if calls != tt.calls {
+			t.Errorf("%s: %d children called, want %d", tt.order, calls, tt.calls)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestHandleNodeSpawn(t *testing.T) {
+	ts, _ := newTestServer(t, nil)
+	// 4 children sleeping 50ms each
+	children := func(spawn string) float64 {
+		code, r := getResult(t, ts.URL+"/sleep?size=5&time=50&spawn="+spawn)
+		if code != http.StatusOK {
+			t.Fatalf("%s: got status %d", spawn, code)
+		}
+		return rootResult(t, r).Children
+	}
+	parallel := children("parallel")
+	batched := children("batched:2")
+	serial := children("serial")
+	if parallel < 50 || parallel >= 100 {
+		t.Errorf("parallel: children took %.1fms, want about 50ms", parallel)
+	}
+	if batched < 100 || batched >= 150 {
+		t.Errorf("batched:2: children took %.1fms, want about 100ms", batched)
+	}
+	if serial < 200 {
+		t.Errorf("serial: children took %.1fms, want about 200ms", serial)
+	}
+}
+
+func TestHandleNodeConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	ts, _ := newTestServer(t, func(r *http.Request) func() {
+		if r.URL.Path != "/internal" {
+			return func() {}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		return func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}
+	}, WithConcurrency(2))
+
+	for _, tt := range []struct {
+		query string
+		max   int
+	}{
+		{"concurrency=3", 3},
+		// server default
+		{"", 2},
+	} {
+		mu.Lock()
+		maxInFlight = 0
+		mu.Unlock()
+		code, _ := getResult(t, ts.URL+"/sleep?size=11&time=30&"+tt.query)
+		if code != http.StatusOK {
+			t.Fatalf("%s: got status %d", tt.query, code)
+		}
+		mu.Lock()
+		if maxInFlight != tt.max {
+			t.Errorf("%s: %d children in flight, want %d", tt.query, maxInFlight, tt.max)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestClientTransport(t *testing.T) {
+	// count new connections, child nodes are served by the same server
+	var mu sync.Mutex
+	conns := 0
+	ts := httptest.NewUnstartedServer(nil)
+	s := NewServer("", "http://"+ts.Listener.Addr().String(), WithConcurrency(5))
+	ts.Config.Handler = s.server.Handler
+	ts.Config.ConnState = func(c net.Conn, st http.ConnState) {
+		if st == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	tr, ok := s.client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("got transport %T", s.client.Transport)
+	}
+	if tr.MaxIdleConnsPerHost != 5 || tr.MaxIdleConns != 20 || tr.MaxConnsPerHost != 0 {
+		t.Errorf("got idle connections %d per host, %d total, limit %d",
+			tr.MaxIdleConnsPerHost, tr.MaxIdleConns, tr.MaxConnsPerHost)
+	}
+
+	// connections to child nodes are reused by subsequent requests
+	count := func() int {
+		if code, _ := getResult(t, ts.URL+"/sleep?size=5&time=10"); code != http.StatusOK {
+			t.Fatalf("got status %d", code)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		n := conns
+		conns = 0
+		return n
+	}
+	if n := count(); n < 2 {
+		t.Errorf("%d new connections, want connections to child nodes", n)
+	}
+	// at most a new connection of the external client
+	if n := count(); n > 1 {
+		t.Errorf("%d new connections, want child connections reused", n)
+	}
+}
+
+func TestGraphBodyLimit(t *testing.T) {
+	ts, _ := newTestServer(t, nil, WithMaxSize(10))
+	// valid JSON, too large for a graph of 10 nodes
+	body := `{"nodes": [{"index": 1}], "padding": "` +
+		strings.Repeat("x", int(maxGraphBytes(10))) + `"}`
+	for _, path := range []string{"/", "/plan"} {
+		resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", path,
+				resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+	resp, err := http.Post(ts.URL+"/plan", "application/json",
+		strings.NewReader(`{"nodes": [{"index": 1}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+// loop returns invalid children
+type loop struct{}
+
+func (loop) Setup(t *Tree, q url.Values) error {
+	return nil
+}
+
+func (loop) Children(t *Tree, p Position) []Position {
+	return []Position{
+		{Index: p.Index, Depth: p.Depth + 1},     // itself
+		{Index: p.Index - 1, Depth: p.Depth + 1}, // parent
+		{Index: t.Size + 1, Depth: p.Depth + 1},  // beyond size
+		{Index: p.Index + 1, Depth: p.Depth},     // wrong depth
+		{Index: p.Index + 1, Depth: p.Depth + 1}, // valid
+	}
+}
+
+func TestInvalidTopologyChildren(t *testing.T) {
+	const name = "test-loop"
+	RegisterTopology(name, loop{})
+	t.Cleanup(func() {
+		topologies.Lock()
+		delete(topologies.m, name)
+		topologies.Unlock()
+	})
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	u, _ := url.Parse("/?topology=" + name + "&size=5")
+	n, err := newNodeFromURL(u, defaultMaxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a chain of valid children only
+	if got := len(walk(n)); got != 5 {
+		t.Errorf("got %d nodes, want 5", got)
+	}
+	if p := newPlan(n); p.Calls != 5 || p.Depth != 4 {
+		t.Errorf("got plan of %d calls, depth %d, want 5, 4", p.Calls, p.Depth)
+	}
+}